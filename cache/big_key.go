@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sizeBuckets 值大小分布的桶上限, 超过最后一个上限的值落在最后一个桶
+var sizeBuckets = []int{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+// SizeStats 某个 key 前缀下写入值的大小分布
+type SizeStats struct {
+	Count      int64
+	TotalBytes int64
+	MaxBytes   int
+	MaxKey     string
+	// Buckets[i] 为大小不超过 sizeBuckets[i] 的写入次数, 最后一个元素为超过所有上限的写入次数
+	Buckets []int64
+}
+
+// BigKeyCache 在 Set 的时候统计值的大小分布, 并且可以拒绝或者告警超过 limit 的值
+// 默认只统计 []byte 和 string, 其它类型可以通过 WithSizeFunc 估计大小
+type BigKeyCache struct {
+	Cache
+
+	mutex sync.Mutex
+	stats map[string]*SizeStats
+
+	prefix func(key string) string
+	sizeOf func(value any) (int, bool)
+	// limit 为 0 表示不限制
+	limit    int
+	reject   bool
+	onBigKey func(key string, size int)
+}
+
+type BigKeyCacheOption func(b *BigKeyCache)
+
+// WithSizeLimit 值超过 limit 字节时, reject 为 true 返回 errs.ErrValueTooLarge, 否则只告警
+func WithSizeLimit(limit int, reject bool) BigKeyCacheOption {
+	return func(b *BigKeyCache) {
+		b.limit = limit
+		b.reject = reject
+	}
+}
+
+// WithKeyPrefix 提取 key 的前缀作为统计的维度, 默认取第一个 : 之前的部分, 没有 : 的 key 统一归到 "" 下
+// 返回值的种类决定了统计结果占用的内存, 不要直接返回 key
+func WithKeyPrefix(prefix func(key string) string) BigKeyCacheOption {
+	return func(b *BigKeyCache) {
+		b.prefix = prefix
+	}
+}
+
+// WithOnBigKey 值超过 limit 时的回调, 默认打印日志
+func WithOnBigKey(fn func(key string, size int)) BigKeyCacheOption {
+	return func(b *BigKeyCache) {
+		b.onBigKey = fn
+	}
+}
+
+// WithSizeFunc 估计值的大小, 返回 false 表示无法估计, 该值不参与统计和限制
+// 每次 Set 都会调用, 应该足够轻量, 例如不要为了估计大小而重新编码整个值
+func WithSizeFunc(fn func(value any) (int, bool)) BigKeyCacheOption {
+	return func(b *BigKeyCache) {
+		b.sizeOf = fn
+	}
+}
+
+func NewBigKeyCache(cache Cache, opts ...BigKeyCacheOption) *BigKeyCache {
+	res := &BigKeyCache{
+		Cache:  cache,
+		stats:  map[string]*SizeStats{},
+		prefix: defaultKeyPrefix,
+		sizeOf: defaultSizeOf,
+		onBigKey: func(key string, size int) {
+			log.Printf("cache: 写入大 key %s, 大小: %d", key, size)
+		},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (b *BigKeyCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	size, ok := b.sizeOf(value)
+	if !ok {
+		// 无法估计大小的值不参与统计, 交给底层缓存处理
+		return b.Cache.Set(ctx, key, value, expireTime)
+	}
+	if b.limit > 0 && size > b.limit {
+		if b.reject {
+			return fmt.Errorf("%w, key: %s, 大小: %d, 上限: %d", errs.ErrValueTooLarge, key, size, b.limit)
+		}
+		b.onBigKey(key, size)
+	}
+	err := b.Cache.Set(ctx, key, value, expireTime)
+	if err != nil {
+		return err
+	}
+	b.record(key, size)
+	return nil
+}
+
+// Stats 按照前缀返回统计结果的快照
+func (b *BigKeyCache) Stats() map[string]SizeStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	res := make(map[string]SizeStats, len(b.stats))
+	for prefix, s := range b.stats {
+		cp := *s
+		cp.Buckets = append([]int64(nil), s.Buckets...)
+		res[prefix] = cp
+	}
+	return res
+}
+
+func (b *BigKeyCache) record(key string, size int) {
+	prefix := b.prefix(key)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s, ok := b.stats[prefix]
+	if !ok {
+		s = &SizeStats{Buckets: make([]int64, len(sizeBuckets)+1)}
+		b.stats[prefix] = s
+	}
+	s.Count++
+	s.TotalBytes += int64(size)
+	if size > s.MaxBytes || s.Count == 1 {
+		s.MaxBytes = size
+		s.MaxKey = key
+	}
+	s.Buckets[sort.SearchInts(sizeBuckets, size)]++
+}
+
+// defaultSizeOf 只统计 []byte 和 string
+func defaultSizeOf(value any) (int, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return len(v), true
+	case string:
+		return len(v), true
+	default:
+		return 0, false
+	}
+}
+
+func defaultKeyPrefix(key string) string {
+	if idx := strings.IndexByte(key, ':'); idx >= 0 {
+		return key[:idx]
+	}
+	// 没有前缀的 key 如果各自统计, stats 会随着 key 的数量无限增长
+	return ""
+}
+
+// BigKey 扫描得到的 key 以及占用的内存(字节)
+type BigKey struct {
+	Key   string
+	Bytes int64
+}
+
+// BigKeyScanner 使用 SCAN 遍历 redis, 通过 MEMORY USAGE 找出占用内存最多的 key
+// SCAN 只遍历一个节点, 集群模式下需要通过 ClusterClient.ForEachMaster 对每个主节点分别扫描
+// MEMORY USAGE 对每个 key 都是一次请求, 应该在从节点或者低峰期执行
+type BigKeyScanner struct {
+	client redis.Cmdable
+	// match 为 SCAN 的 MATCH 参数, 为空时扫描所有 key
+	match string
+	// count 为 SCAN 的 COUNT 参数
+	count int64
+	// samples 为 MEMORY USAGE 对集合类型的采样数, 0 表示使用 redis 的默认值
+	samples int
+	top     int
+}
+
+type BigKeyScannerOption func(s *BigKeyScanner)
+
+func WithScanMatch(match string) BigKeyScannerOption {
+	return func(s *BigKeyScanner) {
+		s.match = match
+	}
+}
+
+func WithScanCount(count int64) BigKeyScannerOption {
+	return func(s *BigKeyScanner) {
+		s.count = count
+	}
+}
+
+func WithMemorySamples(samples int) BigKeyScannerOption {
+	return func(s *BigKeyScanner) {
+		s.samples = samples
+	}
+}
+
+// NewBigKeyScanner top 为返回的 key 数量
+func NewBigKeyScanner(client redis.Cmdable, top int, opts ...BigKeyScannerOption) *BigKeyScanner {
+	res := &BigKeyScanner{
+		client: client,
+		count:  100,
+		top:    top,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// Scan 返回占用内存最多的 top 个 key, 按照大小降序
+// 扫描过程中被删除的 key 会被跳过
+func (s *BigKeyScanner) Scan(ctx context.Context) ([]BigKey, error) {
+	res := make([]BigKey, 0, s.top)
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, s.match, s.count).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			size, err := s.memoryUsage(ctx, key)
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			res = insertBigKey(res, BigKey{Key: key, Bytes: size}, s.top)
+		}
+		if next == 0 {
+			return res, nil
+		}
+		cursor = next
+	}
+}
+
+func (s *BigKeyScanner) memoryUsage(ctx context.Context, key string) (int64, error) {
+	if s.samples > 0 {
+		return s.client.MemoryUsage(ctx, key, s.samples).Result()
+	}
+	return s.client.MemoryUsage(ctx, key).Result()
+}
+
+// insertBigKey 在降序的 keys 中插入 key, 最多保留 top 个
+func insertBigKey(keys []BigKey, key BigKey, top int) []BigKey {
+	idx := sort.Search(len(keys), func(i int) bool {
+		return keys[i].Bytes < key.Bytes
+	})
+	if idx >= top {
+		return keys
+	}
+	if len(keys) < top {
+		keys = append(keys, BigKey{})
+	}
+	copy(keys[idx+1:], keys[idx:])
+	keys[idx] = key
+	return keys
+}
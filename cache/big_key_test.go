@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBigKeyCache_Set(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    []BigKeyCacheOption
+		key     string
+		value   any
+		wantErr error
+		wantBig []string
+		// 不参与统计的值
+		wantNoStats bool
+	}{
+		{
+			name:  "small value",
+			opts:  []BigKeyCacheOption{WithSizeLimit(10, true)},
+			key:   "user:1",
+			value: "abc",
+		},
+		{
+			name:    "reject",
+			opts:    []BigKeyCacheOption{WithSizeLimit(10, true)},
+			key:     "user:1",
+			value:   strings.Repeat("a", 11),
+			wantErr: errs.ErrValueTooLarge,
+		},
+		{
+			name:    "warn",
+			opts:    []BigKeyCacheOption{WithSizeLimit(10, false)},
+			key:     "user:1",
+			value:   []byte(strings.Repeat("a", 11)),
+			wantBig: []string{"user:1"},
+		},
+		{
+			// 默认不估计结构体的大小
+			name:        "struct value",
+			opts:        []BigKeyCacheOption{WithSizeLimit(10, true)},
+			key:         "user:1",
+			value:       codecUser{Name: "Tom", Age: 18},
+			wantNoStats: true,
+		},
+		{
+			name: "size func",
+			opts: []BigKeyCacheOption{WithSizeLimit(10, false), WithSizeFunc(func(value any) (int, bool) {
+				data, err := JSONCodec{}.Encode(value)
+				return len(data), err == nil
+			})},
+			key:     "user:1",
+			value:   codecUser{Name: "Tom", Age: 18},
+			wantBig: []string{"user:1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var big []string
+			opts := append(tc.opts, WithOnBigKey(func(key string, size int) {
+				big = append(big, key)
+			}))
+			local := NewBuildInMapCache(time.Minute)
+			c := NewBigKeyCache(local, opts...)
+			err := c.Set(context.Background(), tc.key, tc.value, time.Minute)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantBig, big)
+			_, err = local.Get(context.Background(), tc.key)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+				assert.Empty(t, c.Stats())
+				return
+			}
+			require.NoError(t, err)
+			if tc.wantNoStats {
+				assert.Empty(t, c.Stats())
+				return
+			}
+			assert.Equal(t, int64(1), c.Stats()["user"].Count)
+		})
+	}
+}
+
+func TestBigKeyCache_Stats(t *testing.T) {
+	c := NewBigKeyCache(NewBuildInMapCache(time.Minute))
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "user:1", strings.Repeat("a", 100), time.Minute))
+	require.NoError(t, c.Set(ctx, "user:2", strings.Repeat("a", 2<<10), time.Minute))
+	require.NoError(t, c.Set(ctx, "order:1", strings.Repeat("a", 20<<20), time.Minute))
+	require.NoError(t, c.Set(ctx, "plain", "a", time.Minute))
+	require.NoError(t, c.Set(ctx, "plain2", "a", time.Minute))
+
+	stats := c.Stats()
+	assert.Equal(t, SizeStats{
+		Count:      2,
+		TotalBytes: 100 + 2<<10,
+		MaxBytes:   2 << 10,
+		MaxKey:     "user:2",
+		Buckets:    []int64{1, 1, 0, 0, 0, 0},
+	}, stats["user"])
+	assert.Equal(t, []int64{0, 0, 0, 0, 0, 1}, stats["order"].Buckets)
+	// 没有前缀的 key 统计在一起
+	assert.Equal(t, int64(2), stats[""].Count)
+	assert.Len(t, stats, 3)
+}
+
+func TestBigKeyScanner_Scan(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		wantRes []BigKey
+		wantErr error
+	}{
+		{
+			name: "top keys",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				first := redis.NewScanCmd(context.Background(), nil)
+				first.SetVal([]string{"a", "b", "deleted"}, 10)
+				cmd.EXPECT().Scan(gomock.Any(), uint64(0), "", int64(100)).Return(first)
+				second := redis.NewScanCmd(context.Background(), nil)
+				second.SetVal([]string{"c", "d"}, 0)
+				cmd.EXPECT().Scan(gomock.Any(), uint64(10), "", int64(100)).Return(second)
+
+				sizes := map[string]int64{"a": 10, "b": 300, "c": 200, "d": 20}
+				for key, size := range sizes {
+					intCmd := redis.NewIntCmd(context.Background())
+					intCmd.SetVal(size)
+					cmd.EXPECT().MemoryUsage(gomock.Any(), key).Return(intCmd)
+				}
+				deleted := redis.NewIntCmd(context.Background())
+				deleted.SetErr(redis.Nil)
+				cmd.EXPECT().MemoryUsage(gomock.Any(), "deleted").Return(deleted)
+				return cmd
+			},
+			wantRes: []BigKey{{Key: "b", Bytes: 300}, {Key: "c", Bytes: 200}, {Key: "d", Bytes: 20}},
+		},
+		{
+			name: "scan error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				scanCmd := redis.NewScanCmd(context.Background(), nil)
+				scanCmd.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Scan(gomock.Any(), uint64(0), "", int64(100)).Return(scanCmd)
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := NewBigKeyScanner(tc.mock(ctrl), 3)
+			res, err := s.Scan(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
@@ -3,29 +3,63 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"geek_cache/internal/errs"
+	"time"
 )
 
 // BloomFilterCache 支持注入布隆过滤器
 // 非侵入式
 type BloomFilterCache struct {
 	ReadThrough
+	// adder 不为 nil 时, 加载成功以及写入成功的 key 会被加入过滤器
+	adder KeyFilter
 }
 
-func NewBloomFilterCache(cache Cache, bf BloomFilter, LoadFunc func(ctx context.Context, key string) (any, error)) *BloomFilterCache {
-	return &BloomFilterCache{
+type BloomFilterCacheOption func(b *BloomFilterCache)
+
+// WithAutoAdd 加载成功以及 Set 成功之后把 key 加入 f, 一般 f 就是构造 bf 的过滤器
+func WithAutoAdd(f KeyFilter) BloomFilterCacheOption {
+	return func(b *BloomFilterCache) {
+		b.adder = f
+	}
+}
+
+func NewBloomFilterCache(cache Cache, bf BloomFilter, LoadFunc func(ctx context.Context, key string) (any, error),
+	opts ...BloomFilterCacheOption) *BloomFilterCache {
+	res := &BloomFilterCache{
 		ReadThrough: ReadThrough{
 			Cache: cache,
-			LoadFunc: func(ctx context.Context, key string) (any, error) {
-				ok := bf.HasKey(ctx, key)
-				if ok {
-					return LoadFunc(ctx, key)
-				}
-				return nil, errs.ErrKeyNotFound
-			},
 		},
 	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.LoadFunc = func(ctx context.Context, key string) (any, error) {
+		ok := bf.HasKey(ctx, key)
+		if !ok {
+			return nil, errs.ErrKeyNotFound
+		}
+		val, err := LoadFunc(ctx, key)
+		if err == nil && res.adder != nil {
+			// 加入失败不影响本次读取
+			_ = res.adder.Add(ctx, key)
+		}
+		return val, err
+	}
+	return res
+}
+
+// Set 写入成功之后把 key 加入过滤器, 否则新写入的数据会被过滤器拦截
+func (b *BloomFilterCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	if err := b.Cache.Set(ctx, key, value, expireTime); err != nil {
+		return err
+	}
+	if b.adder != nil {
+		return b.adder.Add(ctx, key)
+	}
+	return nil
 }
 
 type BloomFilter struct {
@@ -40,7 +74,7 @@ type BloomFilterCacheV1 struct {
 
 func (b *BloomFilterCacheV1) Get(ctx context.Context, key string) (any, error) {
 	data, err := b.Cache.Get(ctx, key)
-	if err == errs.ErrKeyNotFound && b.bf.HasKey(ctx, key) {
+	if errors.Is(err, errs.ErrKeyNotFound) && b.bf.HasKey(ctx, key) {
 		data, err = b.LoadFunc(ctx, key)
 		if err == nil {
 			if e := b.Cache.Set(ctx, key, data, b.ExpireTime); e != nil {
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+var (
+	//go:embed lua/bloom_add.lua
+	bloomAddLua string
+	//go:embed lua/bloom_test.lua
+	bloomTestLua string
+)
+
+var ErrInvalidFilterParams = errors.New("cache: 过滤器参数错误")
+
+// KeyFilter 判断 key 是否可能存在的过滤器
+// Test 返回 false 时 key 一定不存在, 返回 true 时 key 可能存在
+type KeyFilter interface {
+	Add(ctx context.Context, key string) error
+	AddMulti(ctx context.Context, keys []string) error
+	Test(ctx context.Context, key string) (bool, error)
+}
+
+// AsBloomFilter 转换为 BloomFilterCache 使用的 BloomFilter
+// 过滤器出错时当作 key 可能存在, 宁可多查一次数据库也不能把存在的数据当作不存在
+func AsBloomFilter(f KeyFilter) BloomFilter {
+	return BloomFilter{
+		HasKey: func(ctx context.Context, key string) bool {
+			ok, err := f.Test(ctx, key)
+			return err != nil || ok
+		},
+	}
+}
+
+// bloomParams 根据预期元素个数 n 和误判率 p 计算位数组大小 m 和哈希函数个数 k
+// m = -n*ln(p)/(ln2)^2, k = m/n*ln2
+func bloomParams(n uint64, p float64) (uint64, int) {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m == 0 {
+		m = 1
+	}
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return m, k
+}
+
+// validateFPRate 误判率不在 (0, 1) 之间时无法计算位数组的大小, 为 1 时只会得到 1 位的过滤器
+func validateFPRate(fpRate float64) error {
+	if !(fpRate > 0 && fpRate < 1) {
+		return fmt.Errorf("%w, 误判率 %v 必须在 (0, 1) 之间", ErrInvalidFilterParams, fpRate)
+	}
+	return nil
+}
+
+// bloomHash 由 64 位 fnv-1a 经过 splitmix64 混淆得到两个哈希值
+// fnv 对于只有末尾不同的 key 区分度不够, 直接使用误判率会明显偏高
+// 不能使用 maphash 这类带随机种子的哈希, 否则不同的进程计算出来的位置不一样
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return splitMix64(sum), splitMix64(sum^0x9e3779b97f4a7c15) | 1
+}
+
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// bloomLocations 双重哈希模拟 k 个哈希函数, 返回 key 在长度为 m 的数组中对应的 k 个位置
+func bloomLocations(key string, m uint64, k int) []uint64 {
+	h1, h2 := bloomHash(key)
+	res := make([]uint64, k)
+	for i := range res {
+		res[i] = (h1 + uint64(i)*h2) % m
+	}
+	return res
+}
+
+// BitBloomFilter 基于位数组的布隆过滤器, 只能添加不能删除
+type BitBloomFilter struct {
+	mutex sync.RWMutex
+	bits  []uint64
+	m     uint64
+	k     int
+}
+
+// NewBitBloomFilter expectedItems 为预期元素个数, fpRate 为元素个数达到预期时的误判率
+func NewBitBloomFilter(expectedItems uint64, fpRate float64) (*BitBloomFilter, error) {
+	if err := validateFPRate(fpRate); err != nil {
+		return nil, err
+	}
+	return newBitBloomFilter(expectedItems, fpRate), nil
+}
+
+func newBitBloomFilter(expectedItems uint64, fpRate float64) *BitBloomFilter {
+	m, k := bloomParams(expectedItems, fpRate)
+	return &BitBloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (b *BitBloomFilter) Add(ctx context.Context, key string) error {
+	locations := bloomLocations(key, b.m, b.k)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, loc := range locations {
+		b.bits[loc/64] |= 1 << (loc % 64)
+	}
+	return nil
+}
+
+func (b *BitBloomFilter) AddMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		_ = b.Add(ctx, key)
+	}
+	return nil
+}
+
+func (b *BitBloomFilter) Test(ctx context.Context, key string) (bool, error) {
+	locations := bloomLocations(key, b.m, b.k)
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, loc := range locations {
+		if b.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RedisBloomFilter 基于 redis 位图的布隆过滤器, 多个实例共享
+// 位置在客户端计算, 通过 lua 脚本一次性 SETBIT/GETBIT, redis 位图最多 2^32 位
+type RedisBloomFilter struct {
+	client redis.Cmdable
+	key    string
+	m      uint64
+	k      int
+}
+
+func NewRedisBloomFilter(client redis.Cmdable, key string, expectedItems uint64, fpRate float64) (*RedisBloomFilter, error) {
+	if err := validateFPRate(fpRate); err != nil {
+		return nil, err
+	}
+	m, k := bloomParams(expectedItems, fpRate)
+	return &RedisBloomFilter{
+		client: client,
+		key:    key,
+		m:      m,
+		k:      k,
+	}, nil
+}
+
+func (r *RedisBloomFilter) Add(ctx context.Context, key string) error {
+	return r.AddMulti(ctx, []string{key})
+}
+
+func (r *RedisBloomFilter) AddMulti(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keys)*r.k)
+	for _, key := range keys {
+		for _, loc := range bloomLocations(key, r.m, r.k) {
+			args = append(args, loc)
+		}
+	}
+	return r.client.Eval(ctx, bloomAddLua, []string{r.key}, args...).Err()
+}
+
+func (r *RedisBloomFilter) Test(ctx context.Context, key string) (bool, error) {
+	locations := bloomLocations(key, r.m, r.k)
+	args := make([]any, len(locations))
+	for i, loc := range locations {
+		args[i] = loc
+	}
+	res, err := r.client.Eval(ctx, bloomTestLua, []string{r.key}, args...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
@@ -0,0 +1,34 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisBloomFilter_e2e(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Del(ctx, "bloom-filter").Err())
+	defer client.Del(ctx, "bloom-filter")
+
+	f, err := NewRedisBloomFilter(client, "bloom-filter", 1000, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, f.AddMulti(ctx, []string{"key1", "key2"}))
+	for _, key := range []string{"key1", "key2"} {
+		ok, err := f.Test(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := f.Test(ctx, "key3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+)
+
+var (
+	ErrInvalidFilterData = errors.New("cache: 过滤器序列化数据格式错误")
+)
+
+// 序列化数据第一个字节标识过滤器类型
+const (
+	bitBloomFilterKind      byte = 1
+	countingBloomFilterKind byte = 2
+	scalableBloomFilterKind byte = 3
+)
+
+// MarshalBinary 格式: 类型(1) + m(8) + k(4) + 位数组
+func (b *BitBloomFilter) MarshalBinary() ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	var buf bytes.Buffer
+	buf.WriteByte(bitBloomFilterKind)
+	_ = binary.Write(&buf, binary.BigEndian, b.m)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(b.k))
+	_ = binary.Write(&buf, binary.BigEndian, b.bits)
+	return buf.Bytes(), nil
+}
+
+func (b *BitBloomFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	m, k, err := readFilterHeader(r, bitBloomFilterKind)
+	if err != nil {
+		return err
+	}
+	bits := make([]uint64, (m+63)/64)
+	if err = readFilterBody(r, bits); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.m, b.k, b.bits = m, k, bits
+	return nil
+}
+
+// readFilterHeader 读取类型, m 和 k
+func readFilterHeader(r *bytes.Reader, kind byte) (uint64, int, error) {
+	var header struct {
+		Kind byte
+		M    uint64
+		K    uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return 0, 0, fmt.Errorf("%w, 原因：%s", ErrInvalidFilterData, err.Error())
+	}
+	// m 不能超过剩余的数据长度, 避免错误的数据导致分配过大的内存
+	if header.Kind != kind || header.M == 0 || header.K == 0 || header.M > uint64(r.Len())*8 {
+		return 0, 0, ErrInvalidFilterData
+	}
+	return header.M, int(header.K), nil
+}
+
+func readFilterBody(r *bytes.Reader, data any) error {
+	if err := binary.Read(r, binary.BigEndian, data); err != nil {
+		return fmt.Errorf("%w, 原因：%s", ErrInvalidFilterData, err.Error())
+	}
+	if r.Len() != 0 {
+		return ErrInvalidFilterData
+	}
+	return nil
+}
+
+// KeySource 分批遍历所有的 key, 例如分页查询数据库的主键, 每一批调用一次 yield
+type KeySource func(ctx context.Context, yield func(keys []string) error) error
+
+// RebuildFilter 把 source 中所有的 key 加入 f
+func RebuildFilter(ctx context.Context, f KeyFilter, source KeySource) error {
+	return source(ctx, func(keys []string) error {
+		return f.AddMulti(ctx, keys)
+	})
+}
+
+// PersistentFilter 可以序列化的过滤器
+type PersistentFilter interface {
+	KeyFilter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// SaveFilter 把过滤器序列化之后保存在 c 中, 例如 RedisCache 或者 FileCache
+func SaveFilter(ctx context.Context, c Cache, key string, f PersistentFilter) error {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, data, 0)
+}
+
+// LoadFilter 启动时从 c 中恢复过滤器, 不存在或者数据损坏时使用 source 重建并保存
+// 保存之后新增的 key 不在恢复出来的过滤器中, 所以需要定期 SaveFilter, 或者恢复之后再补充增量的 key
+func LoadFilter(ctx context.Context, c Cache, key string, f PersistentFilter, source KeySource) error {
+	val, err := c.Get(ctx, key)
+	if err == nil {
+		// 类型不对和数据损坏一样, 重建
+		if data, er := (BytesCodec{}).Encode(val); er == nil && f.UnmarshalBinary(data) == nil {
+			return nil
+		}
+	} else if !errors.Is(err, errs.ErrKeyNotFound) {
+		return err
+	}
+	if err = RebuildFilter(ctx, f, source); err != nil {
+		return err
+	}
+	return SaveFilter(ctx, c, key, f)
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFilter_MarshalBinary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   func() PersistentFilter
+		restored func() PersistentFilter
+	}{
+		{
+			name: "bit",
+			filter: func() PersistentFilter {
+				res, err := NewBitBloomFilter(100, 0.01)
+				require.NoError(t, err)
+				return res
+			},
+			restored: func() PersistentFilter {
+				return &BitBloomFilter{}
+			},
+		},
+		{
+			name: "counting",
+			filter: func() PersistentFilter {
+				res, err := NewCountingBloomFilter(100, 0.01)
+				require.NoError(t, err)
+				return res
+			},
+			restored: func() PersistentFilter {
+				return &CountingBloomFilter{}
+			},
+		},
+		{
+			name: "scalable",
+			filter: func() PersistentFilter {
+				res, err := NewScalableBloomFilter(10, 0.01)
+				require.NoError(t, err)
+				return res
+			},
+			restored: func() PersistentFilter {
+				return &ScalableBloomFilter{}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := tc.filter()
+			keys := make([]string, 50)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key-%d", i)
+			}
+			require.NoError(t, f.AddMulti(ctx, keys))
+			data, err := f.MarshalBinary()
+			require.NoError(t, err)
+
+			restored := tc.restored()
+			require.NoError(t, restored.UnmarshalBinary(data))
+			for _, key := range keys {
+				ok, err := restored.Test(ctx, key)
+				require.NoError(t, err)
+				assert.True(t, ok)
+			}
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("other-%d", i)
+				want, _ := f.Test(ctx, key)
+				got, _ := restored.Test(ctx, key)
+				assert.Equal(t, want, got)
+			}
+
+			// 数据损坏
+			assert.True(t, errors.Is(restored.UnmarshalBinary(data[:len(data)-1]), ErrInvalidFilterData))
+			assert.True(t, errors.Is(restored.UnmarshalBinary([]byte{0xff}), ErrInvalidFilterData))
+		})
+	}
+}
+
+func TestLoadFilter(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	rebuilds := 0
+	source := func(ctx context.Context, yield func(keys []string) error) error {
+		rebuilds++
+		if err := yield([]string{"key1", "key2"}); err != nil {
+			return err
+		}
+		return yield([]string{"key3"})
+	}
+
+	// 不存在时重建并保存
+	f, err := NewCountingBloomFilter(100, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, LoadFilter(ctx, c, "filter", f, source))
+	assert.Equal(t, 1, rebuilds)
+	ok, _ := f.Test(ctx, "key3")
+	assert.True(t, ok)
+
+	// 存在时直接恢复
+	restored := &CountingBloomFilter{}
+	require.NoError(t, LoadFilter(ctx, c, "filter", restored, source))
+	assert.Equal(t, 1, rebuilds)
+	ok, _ = restored.Test(ctx, "key1")
+	assert.True(t, ok)
+
+	// 数据损坏时重建
+	require.NoError(t, c.Set(ctx, "filter", "broken", 0))
+	rebuilt, err := NewCountingBloomFilter(100, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, LoadFilter(ctx, c, "filter", rebuilt, source))
+	assert.Equal(t, 2, rebuilds)
+	ok, _ = rebuilt.Test(ctx, "key2")
+	assert.True(t, ok)
+
+	// 类型不对时重建
+	require.NoError(t, c.Set(ctx, "filter", 123, 0))
+	rebuilt, err = NewCountingBloomFilter(100, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, LoadFilter(ctx, c, "filter", rebuilt, source))
+	assert.Equal(t, 3, rebuilds)
+}
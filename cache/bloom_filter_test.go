@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/cache/mocks"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBloomParams(t *testing.T) {
+	m, k := bloomParams(1000, 0.01)
+	assert.Equal(t, uint64(9586), m)
+	assert.Equal(t, 7, k)
+}
+
+func TestNewBloomFilter_InvalidFPRate(t *testing.T) {
+	for _, fpRate := range []float64{0, 1, 1.5, -0.1, math.NaN()} {
+		_, err := NewBitBloomFilter(1000, fpRate)
+		assert.True(t, errors.Is(err, ErrInvalidFilterParams))
+		_, err = NewRedisBloomFilter(nil, "bf", 1000, fpRate)
+		assert.True(t, errors.Is(err, ErrInvalidFilterParams))
+	}
+}
+
+func TestBitBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewBitBloomFilter(1000, 0.01)
+	require.NoError(t, err)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	require.NoError(t, f.AddMulti(ctx, keys))
+	// 不会漏判
+	for _, key := range keys {
+		ok, err := f.Test(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	// 误判率接近 1%
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if ok, _ := f.Test(ctx, fmt.Sprintf("other-%d", i)); ok {
+			fp++
+		}
+	}
+	assert.Less(t, fp, 200)
+}
+
+func TestRedisBloomFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	f, err := NewRedisBloomFilter(cmd, "bf", 1000, 0.01)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var args []any
+	for _, key := range []string{"key1", "key2"} {
+		for _, loc := range bloomLocations(key, f.m, f.k) {
+			args = append(args, loc)
+		}
+	}
+	addRes := redis.NewCmd(ctx)
+	addRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(ctx, bloomAddLua, []string{"bf"}, args...).Return(addRes)
+	require.NoError(t, f.AddMulti(ctx, []string{"key1", "key2"}))
+
+	testRes := redis.NewCmd(ctx)
+	testRes.SetVal(int64(0))
+	cmd.EXPECT().Eval(ctx, bloomTestLua, []string{"bf"}, gomock.Any()).Return(testRes)
+	ok, err := f.Test(ctx, "key3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	errRes := redis.NewCmd(ctx)
+	errRes.SetErr(context.DeadlineExceeded)
+	cmd.EXPECT().Eval(ctx, bloomTestLua, []string{"bf"}, gomock.Any()).Return(errRes)
+	// 过滤器出错时当作存在
+	assert.True(t, AsBloomFilter(f).HasKey(ctx, "key3"))
+}
+
+func TestBloomFilterCache_AutoAdd(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewBitBloomFilter(100, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, f.Add(ctx, "loaded"))
+	c := NewBloomFilterCache(NewBuildInMapCache(time.Minute), AsBloomFilter(f),
+		func(ctx context.Context, key string) (any, error) {
+			return "value", nil
+		}, WithAutoAdd(f))
+
+	// 不在过滤器中的 key 不会加载
+	_, err = c.Get(ctx, "unknown")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	val, err := c.Get(ctx, "loaded")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	// 写入之后加入过滤器
+	require.NoError(t, c.Set(ctx, "written", "value", time.Minute))
+	ok, err := f.Test(ctx, "written")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFailedToDeleteCache = errors.New("cache: 删除缓存失败")
+	// ErrFailedToScheduleDelete 第一次删除已经成功, 但是 ctx 结束之前没能投递第二次删除
+	ErrFailedToScheduleDelete = errors.New("cache: 投递延迟删除失败")
+)
+
+// CacheAside 旁路缓存: 先更新 DB, 再删除缓存
+// 为了避免 "删除缓存" 与 "并发读把旧值写回缓存" 之间的竞争, 采用延迟双删:
+// 第一次删除同步进行, 第二次删除在 delay 之后由后台 worker 执行
+type CacheAside struct {
+	Cache
+
+	// 第二次删除的延迟时间, 一般略大于一次读 DB + 写缓存的耗时
+	delay time.Duration
+	// RetryStrategy 是有状态的, 每次删除都需要一个新的
+	newRetry func() RetryStrategy
+	// 删除操作的超时时间(延迟删除不受调用方 ctx 控制)
+	timeout time.Duration
+	// 重试之后依旧删除失败时的回调
+	onDeleteFailed func(key string, err error)
+
+	tasks     chan delayedDelete
+	close     chan struct{}
+	closeOnce sync.Once
+}
+
+type delayedDelete struct {
+	key string
+	at  time.Time
+}
+
+type CacheAsideOption func(c *CacheAside)
+
+func WithDoubleDeleteDelay(delay time.Duration) CacheAsideOption {
+	return func(c *CacheAside) {
+		c.delay = delay
+	}
+}
+
+func WithDeleteRetry(fn func() RetryStrategy) CacheAsideOption {
+	return func(c *CacheAside) {
+		c.newRetry = fn
+	}
+}
+
+func WithDeleteTimeout(timeout time.Duration) CacheAsideOption {
+	return func(c *CacheAside) {
+		c.timeout = timeout
+	}
+}
+
+func WithOnDeleteFailed(fn func(key string, err error)) CacheAsideOption {
+	return func(c *CacheAside) {
+		c.onDeleteFailed = fn
+	}
+}
+
+// WithDoubleDeleteQueueSize 等待执行第二次删除的任务队列长度
+func WithDoubleDeleteQueueSize(size int) CacheAsideOption {
+	return func(c *CacheAside) {
+		c.tasks = make(chan delayedDelete, size)
+	}
+}
+
+func NewCacheAside(cache Cache, opts ...CacheAsideOption) *CacheAside {
+	res := &CacheAside{
+		Cache: cache,
+		delay: time.Second,
+		newRetry: func() RetryStrategy {
+			return &FixedIntervalRetryStrategy{
+				Interval: 100 * time.Millisecond,
+				MaxCnt:   3,
+			}
+		},
+		timeout: time.Second,
+		onDeleteFailed: func(key string, err error) {
+			log.Printf("cache: 延迟删除缓存失败, key: %s, 原因: %s", key, err.Error())
+		},
+		tasks: make(chan delayedDelete, 1024),
+		close: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	go res.loop()
+
+	return res
+}
+
+// Update 更新 DB 然后删除缓存, 并投递一个延迟的第二次删除
+// dbWrite 失败时不会动缓存; 第一次删除失败时依旧会投递第二次删除; Close 之后只执行第一次删除
+// 第一次删除失败时返回 ErrFailedToDeleteCache, 第一次删除成功但是 ctx 结束之前没能投递第二次删除时返回 ErrFailedToScheduleDelete
+func (c *CacheAside) Update(ctx context.Context, key string, dbWrite func(ctx context.Context) error) error {
+	if err := dbWrite(ctx); err != nil {
+		return err
+	}
+	err := c.delete(ctx, key)
+	var scheduleErr error
+	select {
+	case c.tasks <- delayedDelete{key: key, at: time.Now().Add(c.delay)}:
+	case <-c.close:
+		// 关闭之后 worker 不再消费 tasks, 与 Close 一样丢弃延迟删除, 否则队列满了之后会一直阻塞
+	case <-ctx.Done():
+		scheduleErr = ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%w, 原因：%s", ErrFailedToDeleteCache, err.Error())
+	}
+	if scheduleErr != nil {
+		return fmt.Errorf("%w, key: %s, 原因：%s", ErrFailedToScheduleDelete, key, scheduleErr.Error())
+	}
+	return nil
+}
+
+// loop 延迟删除的 worker
+// delay 是固定的, 所以先进入队列的任务一定先到期, 顺序等待即可
+// 删除(包括重试)在单独的 goroutine 中执行, 一个 key 删除失败不会推迟后面的 key
+func (c *CacheAside) loop() {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case t := <-c.tasks:
+			timer.Reset(time.Until(t.at))
+			select {
+			case <-timer.C:
+			case <-c.close:
+				timer.Stop()
+				return
+			}
+			go c.runDelayedDelete(t.key)
+		case <-c.close:
+			return
+		}
+	}
+}
+
+func (c *CacheAside) runDelayedDelete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := c.delete(ctx, key); err != nil {
+		c.onDeleteFailed(key, err)
+	}
+}
+
+// delete 按照重试策略删除缓存
+func (c *CacheAside) delete(ctx context.Context, key string) error {
+	var timer *time.Timer
+	retry := c.newRetry()
+	for {
+		err := c.Cache.Delete(ctx, key)
+		if err == nil {
+			return nil
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			return err
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Close 关闭后台 worker, 尚未执行的延迟删除会被丢弃
+func (c *CacheAside) Close() error {
+	err := errors.New("重复关闭")
+	c.closeOnce.Do(func() {
+		close(c.close)
+		err = nil
+	})
+	return err
+}
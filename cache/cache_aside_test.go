@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheAside_Update(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cache   func() Cache
+		dbWrite func(ctx context.Context) error
+		wantErr error
+		// 是否期望缓存中的 key 被删除
+		wantDeleted bool
+	}{
+		{
+			name: "db write failed",
+			cache: func() Cache {
+				res := NewBuildInMapCache(time.Minute)
+				require.NoError(t, res.Set(context.Background(), "key1", "old", time.Minute))
+				return res
+			},
+			dbWrite: func(ctx context.Context) error {
+				return errors.New("db error")
+			},
+			wantErr: errors.New("db error"),
+		},
+		{
+			name: "delete",
+			cache: func() Cache {
+				res := NewBuildInMapCache(time.Minute)
+				require.NoError(t, res.Set(context.Background(), "key1", "old", time.Minute))
+				return res
+			},
+			dbWrite: func(ctx context.Context) error {
+				return nil
+			},
+			wantDeleted: true,
+		},
+		{
+			name: "delete after retry",
+			cache: func() Cache {
+				res := NewBuildInMapCache(time.Minute)
+				require.NoError(t, res.Set(context.Background(), "key1", "old", time.Minute))
+				return &failNDeleteCache{Cache: res, n: 2}
+			},
+			dbWrite: func(ctx context.Context) error {
+				return nil
+			},
+			wantDeleted: true,
+		},
+		{
+			name: "delete failed",
+			cache: func() Cache {
+				res := NewBuildInMapCache(time.Minute)
+				require.NoError(t, res.Set(context.Background(), "key1", "old", time.Minute))
+				return &failNDeleteCache{Cache: res, n: 100}
+			},
+			dbWrite: func(ctx context.Context) error {
+				return nil
+			},
+			wantErr: errors.New("cache: 删除缓存失败, 原因：delete error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ca := NewCacheAside(tc.cache(),
+				WithDoubleDeleteDelay(time.Millisecond),
+				WithDeleteRetry(func() RetryStrategy {
+					return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}
+				}))
+			defer ca.Close()
+			err := ca.Update(context.Background(), "key1", tc.dbWrite)
+			if tc.wantErr != nil {
+				assert.EqualError(t, err, tc.wantErr.Error())
+			} else {
+				require.NoError(t, err)
+			}
+			_, err = ca.Get(context.Background(), "key1")
+			assert.Equal(t, tc.wantDeleted, errors.Is(err, errs.ErrKeyNotFound))
+		})
+	}
+}
+
+func TestCacheAside_DelayedDelete(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	failed := make(chan string, 1)
+	ca := NewCacheAside(local,
+		WithDoubleDeleteDelay(100*time.Millisecond),
+		WithOnDeleteFailed(func(key string, err error) {
+			failed <- key
+		}))
+	defer ca.Close()
+
+	err := ca.Update(context.Background(), "key1", func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 模拟并发读在第一次删除后把旧值写回了缓存
+	require.NoError(t, local.Set(context.Background(), "key1", "stale", time.Minute))
+	val, err := local.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "stale", val)
+
+	time.Sleep(300 * time.Millisecond)
+	_, err = local.Get(context.Background(), "key1")
+	assert.ErrorIs(t, err, errs.ErrKeyNotFound)
+	assert.Len(t, failed, 0)
+}
+
+func TestCacheAside_Close(t *testing.T) {
+	ca := NewCacheAside(NewBuildInMapCache(time.Minute))
+	require.NoError(t, ca.Close())
+	assert.Error(t, ca.Close())
+}
+
+func TestCacheAside_UpdateAfterClose(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	ca := NewCacheAside(local, WithDoubleDeleteQueueSize(1))
+	require.NoError(t, ca.Close())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 队列满了之后也不能阻塞
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, local.Set(context.Background(), "key1", "old", time.Minute))
+			assert.NoError(t, ca.Update(context.Background(), "key1", func(ctx context.Context) error {
+				return nil
+			}))
+			_, err := local.Get(context.Background(), "key1")
+			assert.ErrorIs(t, err, errs.ErrKeyNotFound)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close 之后 Update 被阻塞")
+	}
+}
+
+func TestCacheAside_ScheduleFailed(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	ca := NewCacheAside(local, WithDoubleDeleteDelay(time.Minute), WithDoubleDeleteQueueSize(1))
+	defer ca.Close()
+	dbWrite := func(ctx context.Context) error {
+		return nil
+	}
+	// worker 取走一个, 队列中放一个
+	require.NoError(t, ca.Update(context.Background(), "key1", dbWrite))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, ca.Update(context.Background(), "key1", dbWrite))
+
+	require.NoError(t, local.Set(context.Background(), "key1", "old", time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := ca.Update(ctx, "key1", dbWrite)
+	// 第一次删除已经成功, 只是没能投递第二次删除
+	assert.True(t, errors.Is(err, ErrFailedToScheduleDelete))
+	assert.False(t, errors.Is(err, ErrFailedToDeleteCache))
+	_, err = local.Get(context.Background(), "key1")
+	assert.ErrorIs(t, err, errs.ErrKeyNotFound)
+}
+
+func TestCacheAside_SlowDelayedDelete(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	c := &slowDeleteCache{Cache: local, deleted: make(chan string, 10)}
+	ca := NewCacheAside(c, WithDoubleDeleteDelay(10*time.Millisecond), WithDeleteTimeout(time.Second),
+		WithOnDeleteFailed(func(key string, err error) {}))
+	defer ca.Close()
+	dbWrite := func(ctx context.Context) error {
+		return nil
+	}
+	require.NoError(t, ca.Update(context.Background(), "slow", dbWrite))
+	require.NoError(t, ca.Update(context.Background(), "fast", dbWrite))
+	<-c.deleted
+	<-c.deleted
+	// slow 的第二次删除会一直阻塞到超时, 不能推迟 fast 的第二次删除
+	select {
+	case key := <-c.deleted:
+		assert.Equal(t, "fast", key)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("第二次删除被前面的 key 阻塞")
+	}
+}
+
+// slowDeleteCache key 为 slow 时, 第一次之后的 Delete 阻塞到 ctx 结束
+type slowDeleteCache struct {
+	Cache
+	slowCnt int32
+	deleted chan string
+}
+
+func (s *slowDeleteCache) Delete(ctx context.Context, key string) error {
+	if key == "slow" && atomic.AddInt32(&s.slowCnt, 1) > 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.deleted <- key
+	return s.Cache.Delete(ctx, key)
+}
+
+// failNDeleteCache 前 n 次 Delete 返回错误
+type failNDeleteCache struct {
+	Cache
+	n   int32
+	cnt int32
+}
+
+func (f *failNDeleteCache) Delete(ctx context.Context, key string) error {
+	if atomic.AddInt32(&f.cnt, 1) <= f.n {
+		return errors.New("delete error")
+	}
+	return f.Cache.Delete(ctx, key)
+}
@@ -0,0 +1,172 @@
+// Package cachetest 提供 cache.Cache 实现的一致性测试
+// 所有实现都需要满足同一套语义, 这样 ReadThrough 等装饰器才能在任意实现上工作:
+//   - 未命中(包括已过期)时返回的 error 满足 errors.Is(err, errs.ErrKeyNotFound)
+//   - Delete 不存在的 key 不返回 error
+//   - LoadAndDelete 返回被删除的值, 未命中时与 Get 一致
+//   - 重复 Set 覆盖值和过期时间, expireTime 为 0 表示永不过期
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/cache"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RunSuite 对 newCache 返回的缓存运行一致性测试
+// 每个用例都会调用一次 newCache, 用例之间使用不同的 key, 所以可以共享同一个 redis
+// key 中不包含空格, memcached 的 key 不允许出现空格
+// 写入的值统一为 string, Get 返回 string 或者 []byte 都认为是正确的
+func RunSuite(t *testing.T, newCache func(t *testing.T) cache.Cache) {
+	prefix := fmt.Sprintf("cachetest:%d:", time.Now().UnixNano())
+	testCases := []struct {
+		name string
+		test func(t *testing.T, c cache.Cache, key string)
+	}{
+		{name: "get miss", test: testGetMiss},
+		{name: "set and get", test: testSetGet},
+		{name: "overwrite", test: testOverwrite},
+		{name: "expire", test: testExpire},
+		{name: "overwrite expiration", test: testOverwriteExpiration},
+		{name: "delete", test: testDelete},
+		{name: "delete miss", test: testDeleteMiss},
+		{name: "load and delete", test: testLoadAndDelete},
+		{name: "load and delete miss", test: testLoadAndDeleteMiss},
+		{name: "load and delete expired", test: testLoadAndDeleteExpired},
+		{name: "concurrency", test: testConcurrency},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newCache(t), prefix+strings.ReplaceAll(tc.name, " ", "_"))
+		})
+	}
+}
+
+func testGetMiss(t *testing.T, c cache.Cache, key string) {
+	_, err := c.Get(context.Background(), key)
+	assertNotFound(t, err)
+}
+
+func testSetGet(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", time.Minute))
+	val, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assertValue(t, "value1", val)
+}
+
+func testOverwrite(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", time.Minute))
+	require.NoError(t, c.Set(ctx, key, "value2", time.Minute))
+	val, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assertValue(t, "value2", val)
+}
+
+func testExpire(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", 500*time.Millisecond))
+	val, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assertValue(t, "value1", val)
+	time.Sleep(time.Second)
+	_, err = c.Get(ctx, key)
+	assertNotFound(t, err)
+}
+
+func testOverwriteExpiration(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", 500*time.Millisecond))
+	require.NoError(t, c.Set(ctx, key, "value2", 0))
+	time.Sleep(time.Second)
+	val, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assertValue(t, "value2", val)
+	require.NoError(t, c.Delete(ctx, key))
+}
+
+func testDelete(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", time.Minute))
+	require.NoError(t, c.Delete(ctx, key))
+	_, err := c.Get(ctx, key)
+	assertNotFound(t, err)
+}
+
+func testDeleteMiss(t *testing.T, c cache.Cache, key string) {
+	assert.NoError(t, c.Delete(context.Background(), key))
+}
+
+func testLoadAndDelete(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", time.Minute))
+	val, err := c.LoadAndDelete(ctx, key)
+	require.NoError(t, err)
+	assertValue(t, "value1", val)
+	_, err = c.Get(ctx, key)
+	assertNotFound(t, err)
+}
+
+func testLoadAndDeleteMiss(t *testing.T, c cache.Cache, key string) {
+	_, err := c.LoadAndDelete(context.Background(), key)
+	assertNotFound(t, err)
+}
+
+func testLoadAndDeleteExpired(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, key, "value1", 500*time.Millisecond))
+	time.Sleep(time.Second)
+	_, err := c.LoadAndDelete(ctx, key)
+	assertNotFound(t, err)
+}
+
+func testConcurrency(t *testing.T, c cache.Cache, key string) {
+	ctx := context.Background()
+	const n = 20
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			k := fmt.Sprintf("%s:%d", key, i)
+			val := fmt.Sprintf("value%d", i)
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, c.Set(ctx, k, val, time.Minute))
+				res, err := c.Get(ctx, k)
+				assert.NoError(t, err)
+				assertValue(t, val, res)
+				// 所有 goroutine 同时读写同一个 key
+				assert.NoError(t, c.Set(ctx, key, val, time.Minute))
+				_, err = c.Get(ctx, key)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, c.Delete(ctx, k))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, c.Delete(ctx, key))
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	assert.Truef(t, errors.Is(err, errs.ErrKeyNotFound), "期望 errs.ErrKeyNotFound, 实际 %v", err)
+}
+
+func assertValue(t *testing.T, want string, val any) {
+	t.Helper()
+	switch v := val.(type) {
+	case []byte:
+		assert.Equal(t, want, string(v))
+	default:
+		assert.Equal(t, want, v)
+	}
+}
@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen = errors.New("cache: 熔断器已打开")
+)
+
+type CircuitState int
+
+const (
+	// StateClosed 正常状态, 所有请求访问后端并统计错误率和慢请求比例
+	StateClosed CircuitState = iota
+	// StateOpen 熔断状态, 请求不访问后端, 直接降级
+	StateOpen
+	// StateHalfOpen 探测状态, 只放行少量请求, 全部成功则关闭, 任意一个失败则重新打开
+	StateHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// circuitBreaker 熔断器状态机
+// 关闭状态下每个统计窗口重新计数, 请求数不少于 minRequests 并且错误率或者慢请求比例超过阈值时打开
+// 打开 openTimeout 之后进入半开状态
+type circuitBreaker struct {
+	mutex sync.Mutex
+	state CircuitState
+	// generation 每次状态变化时递增, 用于忽略上一个状态中发出的请求的结果
+	generation  uint64
+	windowStart time.Time
+	openedAt    time.Time
+
+	total    int
+	failures int
+	slow     int
+	// 半开状态下已经放行和已经成功的请求数
+	probes    int
+	successes int
+
+	errorRate     float64
+	slowThreshold time.Duration
+	slowRate      float64
+	minRequests   int
+	window        time.Duration
+	openTimeout   time.Duration
+	halfOpenMax   int
+
+	onStateChange func(from, to CircuitState)
+	now           func() time.Time
+}
+
+// allow 返回是否放行请求以及当前的 generation
+func (b *circuitBreaker) allow() (uint64, bool) {
+	b.mutex.Lock()
+	now := b.now()
+	from := b.state
+	switch b.state {
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.window {
+			b.resetCounts(now)
+		}
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.openTimeout {
+			b.setState(StateHalfOpen, now)
+		}
+	}
+	ok := b.state != StateOpen
+	if b.state == StateHalfOpen {
+		ok = b.probes < b.halfOpenMax
+		if ok {
+			b.probes++
+		}
+	}
+	gen, to := b.generation, b.state
+	b.mutex.Unlock()
+	b.notify(from, to)
+	return gen, ok
+}
+
+// record 记录请求结果, generation 不一致说明状态已经变化, 结果被忽略
+func (b *circuitBreaker) record(gen uint64, failed bool, cost time.Duration) {
+	slow := b.slowThreshold > 0 && cost > b.slowThreshold
+	b.mutex.Lock()
+	if gen != b.generation {
+		b.mutex.Unlock()
+		return
+	}
+	from := b.state
+	now := b.now()
+	switch b.state {
+	case StateClosed:
+		b.total++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if b.total >= b.minRequests && b.tripped() {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failed || slow {
+			b.setState(StateOpen, now)
+		} else if b.successes++; b.successes >= b.halfOpenMax {
+			b.setState(StateClosed, now)
+		}
+	}
+	to := b.state
+	b.mutex.Unlock()
+	b.notify(from, to)
+}
+
+func (b *circuitBreaker) tripped() bool {
+	total := float64(b.total)
+	if b.errorRate > 0 && float64(b.failures)/total >= b.errorRate {
+		return true
+	}
+	return b.slowThreshold > 0 && b.slowRate > 0 && float64(b.slow)/total >= b.slowRate
+}
+
+func (b *circuitBreaker) setState(state CircuitState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.resetCounts(now)
+	if state == StateOpen {
+		b.openedAt = now
+	}
+}
+
+func (b *circuitBreaker) resetCounts(now time.Time) {
+	b.windowStart = now
+	b.total, b.failures, b.slow = 0, 0, 0
+	b.probes, b.successes = 0, 0
+}
+
+// notify 在锁外调用回调, 避免回调中访问熔断器导致死锁
+func (b *circuitBreaker) notify(from, to CircuitState) {
+	if from == to || b.onStateChange == nil {
+		return
+	}
+	b.onStateChange(from, to)
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// CircuitBreakerCache 熔断装饰器, 一般装饰 RedisCache
+// redis 变慢或者不可用时, 请求不再等待超时, 而是直接降级:
+//   - 没有配置 fallback 时, Get 返回 errs.ErrKeyNotFound, 调用方按照未命中处理(例如回源数据库)
+//   - 配置了 fallback 时, Get 读取 fallback. fallback 中的数据来自熔断器关闭时成功的读写
+//
+// 熔断期间 Set, Delete 和 LoadAndDelete 只作用于 fallback, 并返回 ErrCircuitOpen, 调用方需要知道后端没有被修改
+// 未命中(errs.ErrKeyNotFound)和调用方取消(context.Canceled)不算失败
+type CircuitBreakerCache struct {
+	Cache
+	breaker *circuitBreaker
+
+	fallback           *BuildInMapCache
+	fallbackExpiration time.Duration
+}
+
+type CircuitBreakerCacheOption func(c *CircuitBreakerCache)
+
+// WithErrorRateThreshold 错误率不小于 rate 时打开, 0 表示不按照错误率熔断
+func WithErrorRateThreshold(rate float64) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.errorRate = rate
+	}
+}
+
+// WithSlowCallThreshold 耗时超过 latency 的请求为慢请求, 慢请求比例不小于 rate 时打开
+func WithSlowCallThreshold(latency time.Duration, rate float64) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.slowThreshold = latency
+		c.breaker.slowRate = rate
+	}
+}
+
+// WithMinRequests 统计窗口内的请求数达到 n 之后才会判断是否熔断
+func WithMinRequests(n int) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.minRequests = n
+	}
+}
+
+func WithStatWindow(window time.Duration) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.window = window
+	}
+}
+
+// WithOpenTimeout 打开之后经过 timeout 进入半开状态
+func WithOpenTimeout(timeout time.Duration) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenRequests 半开状态下放行的请求数, 全部成功之后关闭
+func WithHalfOpenRequests(n int) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.halfOpenMax = n
+	}
+}
+
+// WithCircuitFallback 熔断期间使用本地缓存降级, 关闭状态下成功读写的数据会以 expiration 为过期时间写入 local
+func WithCircuitFallback(local *BuildInMapCache, expiration time.Duration) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.fallback = local
+		c.fallbackExpiration = expiration
+	}
+}
+
+// WithStateChangeListener 状态变化时的回调, 在触发状态变化的请求中同步调用
+func WithStateChangeListener(fn func(from, to CircuitState)) CircuitBreakerCacheOption {
+	return func(c *CircuitBreakerCache) {
+		c.breaker.onStateChange = fn
+	}
+}
+
+func NewCircuitBreakerCache(cache Cache, opts ...CircuitBreakerCacheOption) *CircuitBreakerCache {
+	res := &CircuitBreakerCache{
+		Cache: cache,
+		breaker: &circuitBreaker{
+			errorRate:   0.5,
+			minRequests: 20,
+			window:      10 * time.Second,
+			openTimeout: 5 * time.Second,
+			halfOpenMax: 5,
+			now:         time.Now,
+		},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.breaker.windowStart = res.breaker.now()
+	return res
+}
+
+func (c *CircuitBreakerCache) Get(ctx context.Context, key string) (any, error) {
+	gen, ok := c.breaker.allow()
+	if !ok {
+		if c.fallback == nil {
+			return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+		}
+		return c.fallback.Get(ctx, key)
+	}
+	start := time.Now()
+	val, err := c.Cache.Get(ctx, key)
+	c.breaker.record(gen, isBackendFailure(err), time.Since(start))
+	if c.fallback != nil {
+		if err == nil {
+			_ = c.fallback.Set(ctx, key, val, c.fallbackExpiration)
+		} else if errors.Is(err, errs.ErrKeyNotFound) {
+			_ = c.fallback.Delete(ctx, key)
+		}
+	}
+	return val, err
+}
+
+func (c *CircuitBreakerCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	localExpiration := c.fallbackExpiration
+	if expireTime > 0 && expireTime < localExpiration {
+		localExpiration = expireTime
+	}
+	gen, ok := c.breaker.allow()
+	if !ok {
+		if c.fallback != nil {
+			_ = c.fallback.Set(ctx, key, value, localExpiration)
+		}
+		return fmt.Errorf("%w, key: %s", ErrCircuitOpen, key)
+	}
+	start := time.Now()
+	err := c.Cache.Set(ctx, key, value, expireTime)
+	c.breaker.record(gen, isBackendFailure(err), time.Since(start))
+	if c.fallback != nil {
+		if err == nil {
+			_ = c.fallback.Set(ctx, key, value, localExpiration)
+		} else {
+			// 后端的值不确定, 本地也不能保留旧值
+			_ = c.fallback.Delete(ctx, key)
+		}
+	}
+	return err
+}
+
+func (c *CircuitBreakerCache) Delete(ctx context.Context, key string) error {
+	if c.fallback != nil {
+		_ = c.fallback.Delete(ctx, key)
+	}
+	gen, ok := c.breaker.allow()
+	if !ok {
+		return fmt.Errorf("%w, key: %s", ErrCircuitOpen, key)
+	}
+	start := time.Now()
+	err := c.Cache.Delete(ctx, key)
+	c.breaker.record(gen, isBackendFailure(err), time.Since(start))
+	return err
+}
+
+func (c *CircuitBreakerCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	gen, ok := c.breaker.allow()
+	if !ok {
+		if c.fallback != nil {
+			_, _ = c.fallback.LoadAndDelete(ctx, key)
+		}
+		return nil, fmt.Errorf("%w, key: %s", ErrCircuitOpen, key)
+	}
+	start := time.Now()
+	val, err := c.Cache.LoadAndDelete(ctx, key)
+	c.breaker.record(gen, isBackendFailure(err), time.Since(start))
+	if c.fallback != nil {
+		_ = c.fallback.Delete(ctx, key)
+	}
+	return val, err
+}
+
+// State 当前熔断器的状态
+func (c *CircuitBreakerCache) State() CircuitState {
+	return c.breaker.State()
+}
+
+func isBackendFailure(err error) bool {
+	return err != nil && !errors.Is(err, errs.ErrKeyNotFound) && !errors.Is(err, context.Canceled)
+}
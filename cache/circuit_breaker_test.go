@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerCache_ErrorRate(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	remote := &faultyCache{Cache: NewBuildInMapCache(time.Minute)}
+	var events []CircuitState
+	c := NewCircuitBreakerCache(remote,
+		WithErrorRateThreshold(0.5),
+		WithMinRequests(4),
+		WithOpenTimeout(time.Second),
+		WithHalfOpenRequests(2),
+		WithStateChangeListener(func(from, to CircuitState) {
+			events = append(events, to)
+		}))
+	c.breaker.now = clock.Now
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	remote.err = context.DeadlineExceeded
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(ctx, "key1")
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	assert.Equal(t, StateOpen, c.State())
+	calls := remote.calls
+
+	// 打开之后不再访问后端, Get 按照未命中处理, 写操作返回 ErrCircuitOpen
+	_, err := c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.True(t, errors.Is(c.Set(ctx, "key1", "value2", time.Minute), ErrCircuitOpen))
+	assert.True(t, errors.Is(c.Delete(ctx, "key1"), ErrCircuitOpen))
+	assert.Equal(t, calls, remote.calls)
+
+	// 半开状态下探测失败, 重新打开
+	clock.now = clock.now.Add(time.Second)
+	_, err = c.Get(ctx, "key1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, StateOpen, c.State())
+
+	// 探测全部成功之后关闭
+	clock.now = clock.now.Add(time.Second)
+	remote.err = nil
+	for i := 0; i < 2; i++ {
+		val, err := c.Get(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, "value1", val)
+	}
+	assert.Equal(t, StateClosed, c.State())
+	assert.Equal(t, []CircuitState{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, events)
+}
+
+func TestCircuitBreakerCache_HalfOpenLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	c := NewCircuitBreakerCache(NewBuildInMapCache(time.Minute),
+		WithMinRequests(1), WithOpenTimeout(time.Second), WithHalfOpenRequests(2))
+	c.breaker.now = clock.Now
+
+	gen, ok := c.breaker.allow()
+	require.True(t, ok)
+	c.breaker.record(gen, true, 0)
+	assert.Equal(t, StateOpen, c.State())
+
+	clock.now = clock.now.Add(time.Second)
+	_, ok = c.breaker.allow()
+	assert.True(t, ok)
+	_, ok = c.breaker.allow()
+	assert.True(t, ok)
+	// 探测请求还没有返回, 不再放行
+	_, ok = c.breaker.allow()
+	assert.False(t, ok)
+}
+
+func TestCircuitBreakerCache_SlowCall(t *testing.T) {
+	remote := &faultyCache{Cache: NewBuildInMapCache(time.Minute), delay: 20 * time.Millisecond}
+	c := NewCircuitBreakerCache(remote,
+		WithErrorRateThreshold(0),
+		WithSlowCallThreshold(10*time.Millisecond, 0.5),
+		WithMinRequests(2))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, _ = c.Get(ctx, "key1")
+	}
+	assert.Equal(t, StateOpen, c.State())
+}
+
+func TestCircuitBreakerCache_Fallback(t *testing.T) {
+	ctx := context.Background()
+	remote := &faultyCache{Cache: NewBuildInMapCache(time.Minute)}
+	local := NewBuildInMapCache(time.Minute)
+	c := NewCircuitBreakerCache(remote, WithMinRequests(1), WithErrorRateThreshold(0.3),
+		WithCircuitFallback(local, time.Minute))
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, remote.Cache.Set(ctx, "key2", "value2", time.Minute))
+	val, err := c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+
+	remote.err = context.DeadlineExceeded
+	_, err = c.Get(ctx, "key3")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	require.Equal(t, StateOpen, c.State())
+
+	// 熔断期间读取关闭状态下写入或者读取过的数据
+	val, err = c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	val, err = c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+	_, err = c.Get(ctx, "key3")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	// 熔断期间的删除作用于本地
+	assert.True(t, errors.Is(c.Delete(ctx, "key1"), ErrCircuitOpen))
+	_, err = c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
+
+// faultyCache 可以模拟错误和延迟
+type faultyCache struct {
+	Cache
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (f *faultyCache) Get(ctx context.Context, key string) (any, error) {
+	f.calls++
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Cache.Get(ctx, key)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCodecUnsupportedType = errors.New("cache: codec 不支持该类型")
+)
+
+// Codec 负责缓存值的序列化与反序列化
+// 内置 JSONCodec, GobCodec, BytesCodec, 其它格式(protobuf, msgpack 等)由用户自行实现
+type Codec interface {
+	Encode(val any) ([]byte, error)
+	// Decode val 必须是指针
+	Decode(data []byte, val any) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JSONCodec) Decode(data []byte, val any) error {
+	return json.Unmarshal(data, val)
+}
+
+// GobCodec 使用 encoding/gob, 注意 interface 类型的字段需要提前 gob.Register
+type GobCodec struct{}
+
+func (GobCodec) Encode(val any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte, val any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(val)
+}
+
+// BytesCodec 原样存取, 只支持 []byte 和 string
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("%w, 类型 %T", ErrCodecUnsupportedType, val)
+	}
+}
+
+func (BytesCodec) Decode(data []byte, val any) error {
+	switch v := val.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	default:
+		return fmt.Errorf("%w, 类型 %T", ErrCodecUnsupportedType, val)
+	}
+	return nil
+}
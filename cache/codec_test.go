@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type codecUser struct {
+	Name string
+	Age  int
+}
+
+func TestCodec(t *testing.T) {
+	testCases := []struct {
+		name  string
+		codec Codec
+		val   any
+		// 解码目标, 必须是指针
+		dst     func() any
+		wantVal any
+		wantErr error
+	}{
+		{
+			name:  "json",
+			codec: JSONCodec{},
+			val:   codecUser{Name: "Tom", Age: 18},
+			dst: func() any {
+				return &codecUser{}
+			},
+			wantVal: &codecUser{Name: "Tom", Age: 18},
+		},
+		{
+			name:  "gob",
+			codec: GobCodec{},
+			val:   codecUser{Name: "Tom", Age: 18},
+			dst: func() any {
+				return &codecUser{}
+			},
+			wantVal: &codecUser{Name: "Tom", Age: 18},
+		},
+		{
+			name:  "bytes",
+			codec: BytesCodec{},
+			val:   []byte("hello"),
+			dst: func() any {
+				return &[]byte{}
+			},
+			wantVal: &[]byte{'h', 'e', 'l', 'l', 'o'},
+		},
+		{
+			name:  "bytes string",
+			codec: BytesCodec{},
+			val:   "hello",
+			dst: func() any {
+				var s string
+				return &s
+			},
+			wantVal: func() *string {
+				s := "hello"
+				return &s
+			}(),
+		},
+		{
+			name:    "bytes unsupported type",
+			codec:   BytesCodec{},
+			val:     12,
+			wantErr: ErrCodecUnsupportedType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.codec.Encode(tc.val)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			if err != nil {
+				return
+			}
+			dst := tc.dst()
+			require.NoError(t, tc.codec.Decode(data, dst))
+			assert.Equal(t, tc.wantVal, dst)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnknownCompressor = errors.New("cache: 未知的压缩算法")
+	ErrInvalidCompressed = errors.New("cache: 压缩数据格式错误")
+	// ErrReservedCompressorID 自定义算法使用了保留的标识
+	ErrReservedCompressorID = errors.New("cache: 压缩算法标识 0, 1, 2 为保留标识")
+)
+
+// 压缩数据第一个字节为头部, 标识压缩算法
+// noCompression 表示数据未被压缩, 因此压缩与未压缩的数据可以共存
+const (
+	noCompression   byte = 0
+	gzipCompression byte = 1
+	zlibCompression byte = 2
+)
+
+// Compressor 压缩算法, 用户可以自行实现其它算法(snappy, zstd 等)
+type Compressor interface {
+	// ID 写入头部的算法标识, 0 保留给未压缩的数据, 1 和 2 被 gzip 和 zlib 占用
+	// 自定义算法使用这三个标识时 NewCompression 返回 ErrReservedCompressorID
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor Level 为 0 时使用 gzip.DefaultCompression
+type GzipCompressor struct {
+	Level int
+}
+
+func (GzipCompressor) ID() byte {
+	return gzipCompression
+}
+
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, compressLevel(g.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ZlibCompressor Level 为 0 时使用 zlib.DefaultCompression
+type ZlibCompressor struct {
+	Level int
+}
+
+func (ZlibCompressor) ID() byte {
+	return zlibCompression
+}
+
+func (z ZlibCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, compressLevel(z.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (ZlibCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func compressLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// Compression 按照阈值压缩数据并写入头部
+// 解压时根据头部选择算法, 因此切换算法之后旧数据依旧可以读取
+type Compression struct {
+	compressor Compressor
+	threshold  int
+	// 所有可以用来解压的算法
+	compressors map[byte]Compressor
+}
+
+// NewCompression 长度不小于 threshold 的数据使用 compressor 压缩
+// others 为只用于解压的算法, 例如切换算法之前使用的算法
+// 注意: 所有的值都带有一个字节的头部, 引入 CompressCache 之前写入的值没有头部, 无法读取.
+// 迁移时需要清空旧数据, 或者使用新的 key 前缀, 让旧数据自然过期
+func NewCompression(compressor Compressor, threshold int, others ...Compressor) (*Compression, error) {
+	res := &Compression{
+		compressor: compressor,
+		threshold:  threshold,
+		compressors: map[byte]Compressor{
+			gzipCompression: GzipCompressor{},
+			zlibCompression: ZlibCompressor{},
+		},
+	}
+	// 不能 append(others, compressor), 那样会写到调用者的底层数组里
+	for _, c := range others {
+		if err := res.register(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := res.register(compressor); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Compression) register(compressor Compressor) error {
+	if isBuiltinCompressor(compressor) {
+		// 内置算法可以用不同的 Level 压缩, 解压时没有区别
+		return nil
+	}
+	if compressor.ID() <= zlibCompression {
+		return fmt.Errorf("%w, 算法标识 %d", ErrReservedCompressorID, compressor.ID())
+	}
+	c.compressors[compressor.ID()] = compressor
+	return nil
+}
+
+func isBuiltinCompressor(c Compressor) bool {
+	switch c.(type) {
+	case GzipCompressor, *GzipCompressor, ZlibCompressor, *ZlibCompressor:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Compression) Compress(data []byte) ([]byte, error) {
+	if len(data) >= c.threshold {
+		compressed, err := c.compressor.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+		// 压缩之后反而更大, 那就不压缩了
+		if len(compressed) < len(data) {
+			return append([]byte{c.compressor.ID()}, compressed...), nil
+		}
+	}
+	return append([]byte{noCompression}, data...), nil
+}
+
+func (c *Compression) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCompressed
+	}
+	if data[0] == noCompression {
+		return data[1:], nil
+	}
+	compressor, ok := c.compressors[data[0]]
+	if !ok {
+		// 没有头部的旧数据也会走到这里, 参考 NewCompression 的说明
+		return nil, fmt.Errorf("%w, 算法标识 %d", ErrUnknownCompressor, data[0])
+	}
+	return compressor.Decompress(data[1:])
+}
+
+// CompressCache 压缩装饰器, 值必须是 []byte 或者 string, Get 返回 []byte
+// 一般装饰 RedisCache 使用, 结构体可以先用 Codec 编码
+type CompressCache struct {
+	Cache
+	compression *Compression
+}
+
+func NewCompressCache(cache Cache, compression *Compression) *CompressCache {
+	return &CompressCache{
+		Cache:       cache,
+		compression: compression,
+	}
+}
+
+func (c *CompressCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(val)
+}
+
+func (c *CompressCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	data, err := BytesCodec{}.Encode(value)
+	if err != nil {
+		return err
+	}
+	data, err = c.compression.Compress(data)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Set(ctx, key, data, expireTime)
+}
+
+func (c *CompressCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	val, err := c.Cache.LoadAndDelete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(val)
+}
+
+func (c *CompressCache) decompress(val any) (any, error) {
+	// RedisCache 没有配置 codec 时返回的是 string
+	data, err := BytesCodec{}.Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.compression.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
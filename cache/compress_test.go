@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCompression(t *testing.T, compressor Compressor, threshold int, others ...Compressor) *Compression {
+	res, err := NewCompression(compressor, threshold, others...)
+	require.NoError(t, err)
+	return res
+}
+
+// idCompressor 只用来测试算法标识
+type idCompressor struct {
+	GzipCompressor
+	id byte
+}
+
+func (c idCompressor) ID() byte {
+	return c.id
+}
+
+func TestNewCompression(t *testing.T) {
+	for _, id := range []byte{noCompression, gzipCompression, zlibCompression} {
+		_, err := NewCompression(idCompressor{id: id}, 64)
+		assert.True(t, errors.Is(err, ErrReservedCompressorID))
+		_, err = NewCompression(GzipCompressor{}, 64, idCompressor{id: id})
+		assert.True(t, errors.Is(err, ErrReservedCompressorID))
+	}
+	// 内置算法可以使用任意 Level
+	_, err := NewCompression(&ZlibCompressor{Level: 9}, 64, GzipCompressor{Level: 1})
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("hello world "), 100)
+	c := newTestCompression(t, idCompressor{id: 3}, 64)
+	compressed, err := c.Compress(large)
+	require.NoError(t, err)
+	assert.Equal(t, byte(3), compressed[0])
+	data, err := c.Decompress(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, large, data)
+
+	// 不能修改调用者的切片
+	cs := []Compressor{idCompressor{id: 4}, idCompressor{id: 5}}
+	_, err = NewCompression(idCompressor{id: 6}, 64, cs[:1]...)
+	require.NoError(t, err)
+	assert.Equal(t, idCompressor{id: 5}, cs[1])
+}
+
+func TestCompression(t *testing.T) {
+	large := bytes.Repeat([]byte("hello world "), 100)
+	testCases := []struct {
+		name        string
+		compression *Compression
+		data        []byte
+		wantHeader  byte
+	}{
+		{
+			name:        "below threshold",
+			compression: newTestCompression(t, GzipCompressor{}, 1024),
+			data:        []byte("hello"),
+			wantHeader:  noCompression,
+		},
+		{
+			name:        "gzip",
+			compression: newTestCompression(t, GzipCompressor{}, 64),
+			data:        large,
+			wantHeader:  gzipCompression,
+		},
+		{
+			name:        "zlib",
+			compression: newTestCompression(t, ZlibCompressor{Level: 9}, 64),
+			data:        large,
+			wantHeader:  zlibCompression,
+		},
+		{
+			// 压缩之后更大, 不压缩
+			name:        "incompressible",
+			compression: newTestCompression(t, GzipCompressor{}, 0),
+			data:        []byte("a"),
+			wantHeader:  noCompression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			compressed, err := tc.compression.Compress(tc.data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHeader, compressed[0])
+			data, err := tc.compression.Decompress(compressed)
+			require.NoError(t, err)
+			assert.Equal(t, tc.data, data)
+		})
+	}
+}
+
+func TestCompression_Decompress(t *testing.T) {
+	large := bytes.Repeat([]byte("hello world "), 100)
+	// 使用 zlib 压缩的旧数据, 切换到 gzip 之后依旧可以读取
+	old, err := newTestCompression(t, ZlibCompressor{}, 64).Compress(large)
+	require.NoError(t, err)
+	data, err := newTestCompression(t, GzipCompressor{}, 64).Decompress(old)
+	require.NoError(t, err)
+	assert.Equal(t, large, data)
+
+	_, err = newTestCompression(t, GzipCompressor{}, 64).Decompress([]byte{99, 1, 2})
+	assert.True(t, errors.Is(err, ErrUnknownCompressor))
+	_, err = newTestCompression(t, GzipCompressor{}, 64).Decompress(nil)
+	assert.Equal(t, ErrInvalidCompressed, err)
+}
+
+func TestCompressCache(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	c := NewCompressCache(local, newTestCompression(t, GzipCompressor{}, 64))
+	large := strings.Repeat("hello world ", 100)
+	require.NoError(t, c.Set(context.Background(), "key1", large, time.Minute))
+
+	raw, err := local.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Less(t, len(raw.([]byte)), len(large))
+
+	val, err := c.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte(large), val)
+
+	val, err = c.LoadAndDelete(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte(large), val)
+
+	err = c.Set(context.Background(), "key2", 12, time.Minute)
+	assert.True(t, errors.Is(err, ErrCodecUnsupportedType))
+}
@@ -0,0 +1,62 @@
+//go:build e2e
+
+package cache_test
+
+import (
+	"geek_cache/cache"
+	"geek_cache/cache/cachetest"
+	"github.com/go-redis/redis/v9"
+	"testing"
+	"time"
+)
+
+func TestConformance_e2e(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	testCases := []struct {
+		name     string
+		newCache func(t *testing.T) cache.Cache
+	}{
+		{
+			name: "RedisCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewRedisCache(rdb)
+			},
+		},
+		{
+			name: "RedisCache with codec",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewRedisCache(rdb, cache.WithCodec(cache.BytesCodec{}))
+			},
+		},
+		{
+			name: "MultiLevelCache",
+			newCache: func(t *testing.T) cache.Cache {
+				res := cache.NewMultiLevelCache(cache.NewBuildInMapCache(time.Minute), cache.NewRedisCache(rdb), rdb)
+				t.Cleanup(func() {
+					_ = res.Close()
+				})
+				return res
+			},
+		},
+		{
+			name: "ShardedCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewShardedCache(map[string]cache.Cache{
+					"db0": cache.NewRedisCache(rdb),
+					"db1": cache.NewRedisCache(redis.NewClient(&redis.Options{
+						Addr: "localhost:6379",
+						DB:   1,
+					})),
+				})
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cachetest.RunSuite(t, tc.newCache)
+		})
+	}
+}
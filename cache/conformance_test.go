@@ -0,0 +1,96 @@
+package cache_test
+
+import (
+	"bytes"
+	"geek_cache/cache"
+	"geek_cache/cache/cachetest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	testCases := []struct {
+		name     string
+		newCache func(t *testing.T) cache.Cache
+	}{
+		{
+			name: "BuildInMapCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewBuildInMapCache(time.Minute)
+			},
+		},
+		{
+			name: "MaxCntCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.BuildMaxCntCache(cache.NewBuildInMapCache(time.Minute), 1000)
+			},
+		},
+		{
+			name: "CompressCache",
+			newCache: func(t *testing.T) cache.Cache {
+				compression, err := cache.NewCompression(cache.GzipCompressor{}, 4)
+				require.NoError(t, err)
+				return cache.NewCompressCache(cache.NewBuildInMapCache(time.Minute), compression)
+			},
+		},
+		{
+			name: "EncryptCache",
+			newCache: func(t *testing.T) cache.Cache {
+				res, err := cache.NewEncryptCache(cache.NewBuildInMapCache(time.Minute), "v1",
+					map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32)})
+				require.NoError(t, err)
+				return res
+			},
+		},
+		{
+			name: "ShardedCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewShardedCache(map[string]cache.Cache{
+					"shard1": cache.NewBuildInMapCache(time.Minute),
+					"shard2": cache.NewBuildInMapCache(time.Minute),
+				})
+			},
+		},
+		{
+			name: "FileCache",
+			newCache: func(t *testing.T) cache.Cache {
+				res, err := cache.NewFileCache(t.TempDir(), 1<<20)
+				require.NoError(t, err)
+				return res
+			},
+		},
+		{
+			name: "MemcachedCache",
+			newCache: func(t *testing.T) cache.Cache {
+				res := cache.NewMemcachedCache([]string{cache.StartFakeMemcached(t)})
+				t.Cleanup(func() {
+					_ = res.Close()
+				})
+				return res
+			},
+		},
+		{
+			name: "HotKeyCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewHotKeyCache(cache.NewBuildInMapCache(time.Minute),
+					cache.WithHotKeyPromotion(cache.NewBuildInMapCache(time.Minute), 2, time.Minute))
+			},
+		},
+		{
+			name: "CircuitBreakerCache",
+			newCache: func(t *testing.T) cache.Cache {
+				return cache.NewCircuitBreakerCache(cache.NewBuildInMapCache(time.Minute),
+					cache.WithCircuitFallback(cache.NewBuildInMapCache(time.Minute), time.Minute))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cachetest.RunSuite(t, tc.newCache)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// CountingBloomFilter 计数布隆过滤器, 每一位替换为一个 8 位计数器, 因此支持删除
+// 内存占用是 BitBloomFilter 的 8 倍. 计数器达到上限之后不再变化, 避免溢出导致漏判
+// 只能删除确实添加过的 key, 删除没有添加过的 key 可能导致其它 key 被漏判
+type CountingBloomFilter struct {
+	mutex    sync.RWMutex
+	counters []uint8
+	m        uint64
+	k        int
+}
+
+func NewCountingBloomFilter(expectedItems uint64, fpRate float64) (*CountingBloomFilter, error) {
+	if err := validateFPRate(fpRate); err != nil {
+		return nil, err
+	}
+	m, k := bloomParams(expectedItems, fpRate)
+	return &CountingBloomFilter{
+		counters: make([]uint8, m),
+		m:        m,
+		k:        k,
+	}, nil
+}
+
+func (c *CountingBloomFilter) Add(ctx context.Context, key string) error {
+	locations := bloomLocations(key, c.m, c.k)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, loc := range locations {
+		if c.counters[loc] < math.MaxUint8 {
+			c.counters[loc]++
+		}
+	}
+	return nil
+}
+
+func (c *CountingBloomFilter) AddMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		_ = c.Add(ctx, key)
+	}
+	return nil
+}
+
+func (c *CountingBloomFilter) Test(ctx context.Context, key string) (bool, error) {
+	locations := bloomLocations(key, c.m, c.k)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, loc := range locations {
+		if c.counters[loc] == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Remove 删除 key, key 一定不存在(Test 返回 false)时什么也不做
+func (c *CountingBloomFilter) Remove(ctx context.Context, key string) error {
+	locations := bloomLocations(key, c.m, c.k)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, loc := range locations {
+		if c.counters[loc] == 0 {
+			return nil
+		}
+	}
+	for _, loc := range locations {
+		// 达到上限的计数器已经不知道真实的次数了, 不能减少
+		if c.counters[loc] < math.MaxUint8 {
+			c.counters[loc]--
+		}
+	}
+	return nil
+}
+
+// MarshalBinary 格式: 类型(1) + m(8) + k(4) + 计数器
+func (c *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var buf bytes.Buffer
+	buf.WriteByte(countingBloomFilterKind)
+	_ = binary.Write(&buf, binary.BigEndian, c.m)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(c.k))
+	buf.Write(c.counters)
+	return buf.Bytes(), nil
+}
+
+func (c *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	m, k, err := readFilterHeader(r, countingBloomFilterKind)
+	if err != nil {
+		return err
+	}
+	if uint64(r.Len()) != m {
+		return fmt.Errorf("%w, 计数器数量 %d, 数据长度 %d", ErrInvalidFilterData, m, r.Len())
+	}
+	counters := make([]uint8, m)
+	_, _ = r.Read(counters)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.m, c.k, c.counters = m, k, counters
+	return nil
+}
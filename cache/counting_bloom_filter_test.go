@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestCountingBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewCountingBloomFilter(1000, 0.01)
+	require.NoError(t, err)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	require.NoError(t, f.AddMulti(ctx, keys))
+	// 同一个 key 添加两次, 需要删除两次
+	require.NoError(t, f.Add(ctx, "key-0"))
+
+	require.NoError(t, f.Remove(ctx, "key-0"))
+	ok, _ := f.Test(ctx, "key-0")
+	assert.True(t, ok)
+	require.NoError(t, f.Remove(ctx, "key-0"))
+	ok, _ = f.Test(ctx, "key-0")
+	assert.False(t, ok)
+
+	// 删除不影响其它 key
+	for _, key := range keys[1:] {
+		ok, _ = f.Test(ctx, key)
+		assert.True(t, ok)
+	}
+	// 删除不存在的 key 什么也不做
+	require.NoError(t, f.Remove(ctx, "unknown"))
+}
+
+func TestNewCountingBloomFilter_InvalidFPRate(t *testing.T) {
+	for _, fpRate := range []float64{0, 1, 1.5, -0.1} {
+		_, err := NewCountingBloomFilter(1000, fpRate)
+		assert.True(t, errors.Is(err, ErrInvalidFilterParams))
+	}
+}
+
+func TestCountingBloomFilter_Saturated(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewCountingBloomFilter(10, 0.01)
+	require.NoError(t, err)
+	for i := 0; i < math.MaxUint8+10; i++ {
+		require.NoError(t, f.Add(ctx, "key1"))
+	}
+	for i := 0; i < math.MaxUint8+10; i++ {
+		require.NoError(t, f.Remove(ctx, "key1"))
+	}
+	// 计数器溢出之后宁可误判也不能漏判
+	ok, _ := f.Test(ctx, "key1")
+	assert.True(t, ok)
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrFilterFull = errors.New("cache: 过滤器已满")
+
+	//go:embed lua/cuckoo_add.lua
+	cuckooAddLua string
+	//go:embed lua/cuckoo_remove.lua
+	cuckooRemoveLua string
+)
+
+const (
+	cuckooBucketSize = 4
+	cuckooMaxKicks   = 500
+	// 4 个槽位的桶在装载率 95% 左右开始频繁插入失败
+	cuckooLoadFactor = 0.95
+)
+
+// cuckooBuckets 容量为 capacity 时需要的桶数量
+func cuckooBuckets(capacity uint64) uint64 {
+	return uint64(float64(capacity)/cuckooBucketSize/cuckooLoadFactor) + 1
+}
+
+// cuckooLocate 返回 16 位的指纹以及第一个候选桶, 指纹 0 表示空槽位, 所以不能为 0
+func cuckooLocate(key string, n uint64) (uint16, uint64) {
+	h1, h2 := bloomHash(key)
+	fp := uint16(h2 >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h1 % n
+}
+
+// cuckooAltIndex 另一个候选桶, alt(alt(i)) == i, 因此只根据指纹和当前桶就能找到另一个桶
+// 使用减法而不是常见的异或, 桶的数量不需要是 2 的幂, lua 中也只需要普通的算术运算(不超过 2^53, 没有精度问题)
+func cuckooAltIndex(i uint64, fp uint16, n uint64) uint64 {
+	h := uint64(fp) * 1540483477 % n
+	return (h + n - i) % n
+}
+
+// CuckooFilter 布谷鸟过滤器, 每个元素只保存 16 位指纹, 支持删除
+// 误判率约为 2*4/2^16 ≈ 0.012%, 同样的误判率下比布隆过滤器更省空间
+// 容量固定, 插入失败时返回 ErrFilterFull, 已经存在的元素不受影响
+// 同一个 key 可以重复添加(最多 8 次), 每次 Remove 删除一个
+type CuckooFilter struct {
+	mutex   sync.RWMutex
+	buckets [][cuckooBucketSize]uint16
+	n       uint64
+	count   uint64
+}
+
+func NewCuckooFilter(capacity uint64) *CuckooFilter {
+	n := cuckooBuckets(capacity)
+	return &CuckooFilter{
+		buckets: make([][cuckooBucketSize]uint16, n),
+		n:       n,
+	}
+}
+
+func (c *CuckooFilter) Add(ctx context.Context, key string) error {
+	fp, i1 := cuckooLocate(key, c.n)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.insert(i1, fp) {
+		return nil
+	}
+	i := cuckooAltIndex(i1, fp, c.n)
+	if c.insert(i, fp) {
+		return nil
+	}
+
+	type kick struct {
+		i    uint64
+		slot int
+		old  uint16
+	}
+	path := make([]kick, 0, 16)
+	f := fp
+	for k := 0; k < cuckooMaxKicks; k++ {
+		slot := rand.Intn(cuckooBucketSize)
+		old := c.buckets[i][slot]
+		c.buckets[i][slot] = f
+		path = append(path, kick{i: i, slot: slot, old: old})
+		f = old
+		i = cuckooAltIndex(i, f, c.n)
+		if c.insert(i, f) {
+			return nil
+		}
+	}
+	// 恢复被踢出的指纹
+	for k := len(path) - 1; k >= 0; k-- {
+		c.buckets[path[k].i][path[k].slot] = path[k].old
+	}
+	return fmt.Errorf("%w, key: %s", ErrFilterFull, key)
+}
+
+// AddMulti 遇到第一个插入失败的 key 时返回
+func (c *CuckooFilter) AddMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := c.Add(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CuckooFilter) Test(ctx context.Context, key string) (bool, error) {
+	fp, i1 := cuckooLocate(key, c.n)
+	i2 := cuckooAltIndex(i1, fp, c.n)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, f := range c.buckets[i1] {
+		if f == fp {
+			return true, nil
+		}
+	}
+	for _, f := range c.buckets[i2] {
+		if f == fp {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remove 只能删除确实添加过的 key, 否则可能删除其它 key 的指纹
+func (c *CuckooFilter) Remove(ctx context.Context, key string) error {
+	fp, i1 := cuckooLocate(key, c.n)
+	i2 := cuckooAltIndex(i1, fp, c.n)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, i := range []uint64{i1, i2} {
+		for slot, f := range c.buckets[i] {
+			if f == fp {
+				c.buckets[i][slot] = 0
+				c.count--
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Count 当前的元素个数
+func (c *CuckooFilter) Count() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.count
+}
+
+func (c *CuckooFilter) insert(i uint64, fp uint16) bool {
+	for slot, f := range c.buckets[i] {
+		if f == 0 {
+			c.buckets[i][slot] = fp
+			c.count++
+			return true
+		}
+	}
+	return false
+}
+
+// RedisCuckooFilter 基于 redis 字符串的布谷鸟过滤器, 多个实例共享
+// 每个槽位是一个 u16, 第 i 个桶的第 s 个槽位位于 BITFIELD 的 #(i*4+s), 0 表示空槽位,
+// 因此与 CuckooFilter 一样每个元素只占 2 个字节. 字符串最大 512MB, 槽位数不能超过 2^28
+// 插入(包括踢出和失败时的恢复)和删除都在 lua 脚本中完成
+type RedisCuckooFilter struct {
+	client redis.Cmdable
+	key    string
+	n      uint64
+}
+
+func NewRedisCuckooFilter(client redis.Cmdable, key string, capacity uint64) *RedisCuckooFilter {
+	return &RedisCuckooFilter{
+		client: client,
+		key:    key,
+		n:      cuckooBuckets(capacity),
+	}
+}
+
+func (r *RedisCuckooFilter) Add(ctx context.Context, key string) error {
+	fp, i1 := cuckooLocate(key, r.n)
+	res, err := r.client.Eval(ctx, cuckooAddLua, []string{r.key}, r.n, fp, i1, cuckooMaxKicks).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return fmt.Errorf("%w, key: %s", ErrFilterFull, key)
+	}
+	return nil
+}
+
+// AddMulti 遇到第一个插入失败的 key 时返回
+func (r *RedisCuckooFilter) AddMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := r.Add(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisCuckooFilter) Test(ctx context.Context, key string) (bool, error) {
+	fp, slots := r.slots(key)
+	args := make([]any, 0, 3*len(slots))
+	for _, slot := range slots {
+		args = append(args, "get", "u16", "#"+strconv.FormatUint(slot, 10))
+	}
+	vals, err := r.client.BitField(ctx, r.key, args...).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, val := range vals {
+		if val == int64(fp) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *RedisCuckooFilter) Remove(ctx context.Context, key string) error {
+	fp, slots := r.slots(key)
+	args := make([]any, 0, len(slots)+1)
+	args = append(args, fp)
+	for _, slot := range slots {
+		args = append(args, slot)
+	}
+	return r.client.Eval(ctx, cuckooRemoveLua, []string{r.key}, args...).Err()
+}
+
+// slots 两个候选桶的所有槽位
+func (r *RedisCuckooFilter) slots(key string) (uint16, []uint64) {
+	fp, i1 := cuckooLocate(key, r.n)
+	i2 := cuckooAltIndex(i1, fp, r.n)
+	slots := make([]uint64, 0, 2*cuckooBucketSize)
+	for _, i := range []uint64{i1, i2} {
+		for slot := uint64(0); slot < cuckooBucketSize; slot++ {
+			slots = append(slots, i*cuckooBucketSize+slot)
+		}
+	}
+	return fp, slots
+}
@@ -0,0 +1,43 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisCuckooFilter_e2e(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, client.Del(ctx, "cuckoo-filter").Err())
+	defer client.Del(ctx, "cuckoo-filter")
+
+	f := NewRedisCuckooFilter(client, "cuckoo-filter", 100)
+	keys := make([]string, 90)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	require.NoError(t, f.AddMulti(ctx, keys))
+	// 所有槽位保存在一个字符串中
+	typ, err := client.Type(ctx, "cuckoo-filter").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "string", typ)
+	for _, key := range keys {
+		ok, err := f.Test(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	require.NoError(t, f.Remove(ctx, keys[0]))
+	ok, err := f.Test(ctx, keys[0])
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
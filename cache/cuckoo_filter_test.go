@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/cache/mocks"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestCuckooAltIndex(t *testing.T) {
+	for _, n := range []uint64{1, 7, 1024, 1000003} {
+		for i := uint64(0); i < n && i < 100; i++ {
+			for _, fp := range []uint16{1, 255, 65535} {
+				alt := cuckooAltIndex(i, fp, n)
+				assert.Less(t, alt, n)
+				assert.Equal(t, i, cuckooAltIndex(alt, fp, n))
+			}
+		}
+	}
+}
+
+func TestCuckooFilter(t *testing.T) {
+	ctx := context.Background()
+	f := NewCuckooFilter(1000)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	require.NoError(t, f.AddMulti(ctx, keys))
+	assert.Equal(t, uint64(1000), f.Count())
+	for _, key := range keys {
+		ok, err := f.Test(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if ok, _ := f.Test(ctx, fmt.Sprintf("other-%d", i)); ok {
+			fp++
+		}
+	}
+	assert.Less(t, fp, 10)
+
+	for _, key := range keys[:500] {
+		require.NoError(t, f.Remove(ctx, key))
+	}
+	assert.Equal(t, uint64(500), f.Count())
+	for _, key := range keys[500:] {
+		ok, _ := f.Test(ctx, key)
+		assert.True(t, ok)
+	}
+
+	// 可以用在 BloomFilterCache 中
+	assert.True(t, AsBloomFilter(f).HasKey(ctx, keys[999]))
+}
+
+func TestCuckooFilter_Full(t *testing.T) {
+	ctx := context.Background()
+	f := NewCuckooFilter(100)
+	var added []string
+	var err error
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if err = f.Add(ctx, key); err != nil {
+			break
+		}
+		added = append(added, key)
+	}
+	assert.True(t, errors.Is(err, ErrFilterFull))
+	assert.Equal(t, uint64(len(added)), f.Count())
+	// 插入失败不影响已经存在的元素
+	for _, key := range added {
+		ok, _ := f.Test(ctx, key)
+		assert.True(t, ok)
+	}
+}
+
+func TestRedisCuckooFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	ctx := context.Background()
+	f := NewRedisCuckooFilter(cmd, "cf", 1000)
+	fp, i1 := cuckooLocate("key1", f.n)
+	_, slots := f.slots("key1")
+	i2 := cuckooAltIndex(i1, fp, f.n)
+	assert.Equal(t, []uint64{i1 * 4, i1*4 + 1, i1*4 + 2, i1*4 + 3, i2 * 4, i2*4 + 1, i2*4 + 2, i2*4 + 3}, slots)
+
+	full := redis.NewCmd(ctx)
+	full.SetVal(int64(0))
+	cmd.EXPECT().Eval(ctx, cuckooAddLua, []string{"cf"}, f.n, fp, i1, cuckooMaxKicks).Return(full)
+	assert.True(t, errors.Is(f.Add(ctx, "key1"), ErrFilterFull))
+
+	bitfieldArgs := make([]any, 0, 3*len(slots))
+	for _, slot := range slots {
+		bitfieldArgs = append(bitfieldArgs, "get", "u16", "#"+strconv.FormatUint(slot, 10))
+	}
+	hit := redis.NewIntSliceCmd(ctx)
+	hit.SetVal([]int64{0, int64(fp + 1), 0, 0, 0, int64(fp), 0, 0})
+	cmd.EXPECT().BitField(ctx, "cf", bitfieldArgs...).Return(hit)
+	ok, err := f.Test(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	miss := redis.NewIntSliceCmd(ctx)
+	miss.SetVal(make([]int64, 8))
+	cmd.EXPECT().BitField(ctx, "cf", bitfieldArgs...).Return(miss)
+	ok, err = f.Test(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	removed := redis.NewCmd(ctx)
+	removed.SetVal(int64(1))
+	args := []any{fp}
+	for _, slot := range slots {
+		args = append(args, slot)
+	}
+	cmd.EXPECT().Eval(ctx, cuckooRemoveLua, []string{"cf"}, args...).Return(removed)
+	require.NoError(t, f.Remove(ctx, "key1"))
+}
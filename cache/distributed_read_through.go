@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"time"
+)
+
+var (
+	ErrWaitForLoadTimeout = errors.New("cache: 等待其它实例加载数据超时")
+)
+
+// DistributedReadThrough 跨实例防击穿的读穿透
+// singleflight 只能合并一个进程内的加载, 多个实例同时未命中时依旧会同时查询数据库
+// 这里在调用 LoadFunc 之前先使用 Client.TryLock 抢一个由 key 派生出来的分布式锁:
+//   - 抢到锁的实例再检查一次缓存, 依旧未命中才加载并回写缓存, 然后释放锁
+//   - 没抢到锁的实例每隔 retryInterval 检查一次缓存, 直到持有锁的实例回写缓存. 配置了 WithServeStale 时直接返回旧值
+//   - 持有锁的实例崩溃之后锁会过期, 等待的实例会重新抢锁
+//   - 加载的超时时间等于锁的过期时间, 锁过期之后其它实例可以抢到锁, 这时继续加载没有意义
+//   - 锁服务本身出错时退化为普通的读穿透, 保证可用性
+type DistributedReadThrough struct {
+	ReadThrough
+	client *Client
+
+	lockKey        func(key string) string
+	lockExpiration time.Duration
+	retryInterval  time.Duration
+	// waitTimeout 没抢到锁的实例最多等待的时间
+	waitTimeout time.Duration
+	// staleExpiration 为 0 表示不保留旧值
+	staleExpiration time.Duration
+}
+
+type DistributedReadThroughOption func(d *DistributedReadThrough)
+
+// WithLockKey 由缓存的 key 派生锁的 key, 默认为 lock:<key>
+func WithLockKey(fn func(key string) string) DistributedReadThroughOption {
+	return func(d *DistributedReadThrough) {
+		d.lockKey = fn
+	}
+}
+
+// WithLoadLock expiration 为锁的过期时间, 也是加载的超时时间, 应该大于 LoadFunc 的正常耗时
+// retryInterval 为没抢到锁时检查缓存以及重新抢锁的间隔
+func WithLoadLock(expiration time.Duration, retryInterval time.Duration) DistributedReadThroughOption {
+	return func(d *DistributedReadThrough) {
+		d.lockExpiration = expiration
+		d.retryInterval = retryInterval
+	}
+}
+
+func WithWaitTimeout(timeout time.Duration) DistributedReadThroughOption {
+	return func(d *DistributedReadThrough) {
+		d.waitTimeout = timeout
+	}
+}
+
+// WithServeStale 回写缓存时额外保存一份过期时间为 expiration 的旧值, 没抢到锁的实例直接返回旧值
+// expiration 应该大于 ExpireTime
+func WithServeStale(expiration time.Duration) DistributedReadThroughOption {
+	return func(d *DistributedReadThrough) {
+		d.staleExpiration = expiration
+	}
+}
+
+func NewDistributedReadThrough(cache Cache, client *Client,
+	loadFunc func(ctx context.Context, key string) (any, error), expireTime time.Duration,
+	opts ...DistributedReadThroughOption) *DistributedReadThrough {
+	res := &DistributedReadThrough{
+		ReadThrough: ReadThrough{
+			Cache:      cache,
+			LoadFunc:   loadFunc,
+			ExpireTime: expireTime,
+		},
+		client: client,
+		lockKey: func(key string) string {
+			return "lock:" + key
+		},
+		lockExpiration: 3 * time.Second,
+		retryInterval:  50 * time.Millisecond,
+		waitTimeout:    3 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (d *DistributedReadThrough) Get(ctx context.Context, key string) (any, error) {
+	val, err := d.Cache.Get(ctx, key)
+	if !errors.Is(err, errs.ErrKeyNotFound) {
+		return val, err
+	}
+	var timer *time.Timer
+	deadline := time.Now().Add(d.waitTimeout)
+	for {
+		lock, err := d.client.TryLock(ctx, d.lockKey(key), d.lockExpiration)
+		if err == nil {
+			return d.loadWithLock(ctx, key, lock)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrFailedToPreemptLock) {
+			return d.load(ctx, ctx, key)
+		}
+
+		if d.staleExpiration > 0 {
+			if val, err = d.Cache.Get(ctx, staleKey(key)); err == nil {
+				return val, nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w, key: %s", ErrWaitForLoadTimeout, key)
+		}
+		if timer == nil {
+			timer = time.NewTimer(d.retryInterval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(d.retryInterval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		val, err = d.Cache.Get(ctx, key)
+		if !errors.Is(err, errs.ErrKeyNotFound) {
+			return val, err
+		}
+	}
+}
+
+func (d *DistributedReadThrough) loadWithLock(ctx context.Context, key string, lock *Lock) (any, error) {
+	defer func() {
+		// ctx 已经被取消时也要释放锁, 锁已经过期(ErrLockNotHold)不需要处理
+		uctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, time.Second)
+		_ = lock.Unlock(uctx)
+		cancel()
+	}()
+	// 抢锁之前可能刚好有其它实例回写了缓存
+	val, err := d.Cache.Get(ctx, key)
+	if !errors.Is(err, errs.ErrKeyNotFound) {
+		return val, err
+	}
+	lctx, cancel := context.WithTimeout(ctx, d.lockExpiration)
+	defer cancel()
+	return d.load(ctx, lctx, key)
+}
+
+// load 使用 loadCtx 加载, 使用 ctx 回写缓存
+func (d *DistributedReadThrough) load(ctx context.Context, loadCtx context.Context, key string) (any, error) {
+	val, err := d.LoadFunc(loadCtx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Cache.Set(ctx, key, val, d.ExpireTime); err != nil {
+		return val, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, err.Error())
+	}
+	if d.staleExpiration > 0 {
+		if err = d.Cache.Set(ctx, staleKey(key), val, d.staleExpiration); err != nil {
+			return val, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, err.Error())
+		}
+	}
+	return val, nil
+}
+
+func staleKey(key string) string {
+	return key + ":stale"
+}
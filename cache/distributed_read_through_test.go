@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDistributedReadThrough_Get(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(cmd *mocks.MockCmdable)
+		// before 准备本地缓存, after 在第一次未命中之后执行, 模拟其它实例回写缓存
+		before  func(c Cache)
+		after   func(c Cache)
+		opts    []DistributedReadThroughOption
+		wantVal any
+		wantErr error
+		// wantLoads 本实例调用 LoadFunc 的次数
+		wantLoads int32
+	}{
+		{
+			name: "hit",
+			mock: func(cmd *mocks.MockCmdable) {},
+			before: func(c Cache) {
+				_ = c.Set(context.Background(), "key1", "cached", time.Minute)
+			},
+			wantVal: "cached",
+		},
+		{
+			name: "lock and load",
+			mock: func(cmd *mocks.MockCmdable) {
+				expectTryLock(cmd, true, nil)
+				expectUnlock(cmd)
+			},
+			wantVal:   "loaded",
+			wantLoads: 1,
+		},
+		{
+			name: "wait for other instance",
+			mock: func(cmd *mocks.MockCmdable) {
+				expectTryLock(cmd, false, nil)
+			},
+			after: func(c Cache) {
+				_ = c.Set(context.Background(), "key1", "other", time.Minute)
+			},
+			wantVal: "other",
+		},
+		{
+			name: "holder crashed",
+			mock: func(cmd *mocks.MockCmdable) {
+				gomock.InOrder(
+					expectTryLock(cmd, false, nil),
+					expectTryLock(cmd, true, nil),
+				)
+				expectUnlock(cmd)
+			},
+			wantVal:   "loaded",
+			wantLoads: 1,
+		},
+		{
+			name: "serve stale",
+			mock: func(cmd *mocks.MockCmdable) {
+				expectTryLock(cmd, false, nil)
+			},
+			before: func(c Cache) {
+				_ = c.Set(context.Background(), staleKey("key1"), "stale", time.Minute)
+			},
+			opts:    []DistributedReadThroughOption{WithServeStale(time.Hour)},
+			wantVal: "stale",
+		},
+		{
+			name: "wait timeout",
+			mock: func(cmd *mocks.MockCmdable) {
+				expectTryLock(cmd, false, nil).AnyTimes()
+			},
+			opts:    []DistributedReadThroughOption{WithWaitTimeout(30 * time.Millisecond)},
+			wantErr: ErrWaitForLoadTimeout,
+		},
+		{
+			name: "lock service unavailable",
+			mock: func(cmd *mocks.MockCmdable) {
+				expectTryLock(cmd, false, errors.New("connection refused"))
+			},
+			wantVal:   "loaded",
+			wantLoads: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			tc.mock(cmd)
+
+			local := NewBuildInMapCache(time.Minute)
+			if tc.before != nil {
+				tc.before(local)
+			}
+			var loads int32
+			opts := append([]DistributedReadThroughOption{WithLoadLock(time.Second, 10*time.Millisecond)}, tc.opts...)
+			c := NewDistributedReadThrough(&hookCache{Cache: local, afterMiss: tc.after}, NewClient(cmd),
+				func(ctx context.Context, key string) (any, error) {
+					atomic.AddInt32(&loads, 1)
+					return "loaded", nil
+				}, time.Minute, opts...)
+
+			val, err := c.Get(context.Background(), "key1")
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantLoads, loads)
+			if tc.wantErr != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, val)
+			val, err = local.Get(context.Background(), "key1")
+			if tc.wantLoads > 0 {
+				require.NoError(t, err)
+				assert.Equal(t, "loaded", val)
+			}
+		})
+	}
+}
+
+func expectTryLock(cmd *mocks.MockCmdable, ok bool, err error) *gomock.Call {
+	res := redis.NewBoolCmd(context.Background())
+	res.SetVal(ok)
+	res.SetErr(err)
+	return cmd.EXPECT().SetNX(gomock.Any(), "lock:key1", gomock.Any(), time.Second).Return(res)
+}
+
+func expectUnlock(cmd *mocks.MockCmdable) {
+	res := redis.NewCmd(context.Background())
+	res.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"lock:key1"}, gomock.Any()).Return(res)
+}
+
+// hookCache 第一次未命中之后执行 afterMiss, 模拟其它实例在本实例等待期间回写缓存
+type hookCache struct {
+	Cache
+	misses    int
+	afterMiss func(c Cache)
+}
+
+func (h *hookCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := h.Cache.Get(ctx, key)
+	if err != nil && key == "key1" {
+		h.misses++
+		if h.misses == 1 && h.afterMiss != nil {
+			h.afterMiss(h.Cache)
+		}
+	}
+	return val, err
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnknownEncryptionKey = errors.New("cache: 未知的加密密钥")
+	ErrInvalidCiphertext    = errors.New("cache: 密文格式错误")
+)
+
+// EncryptCache 使用 AES-GCM 加密的装饰器, 值必须是 []byte 或者 string, Get 返回 []byte
+// 密文格式: keyID 长度(1 字节) | keyID | nonce | 密文
+// 密文和缓存的 key 绑定(作为 GCM 的附加数据), 因此无法把一个 key 的密文挪到另一个 key 下使用
+//
+// 密钥轮换: 新的密钥作为 currentKeyID 加入, 旧的密钥保留在 keys 中,
+// 新写入的值使用新密钥加密, 旧值依旧可以解密, 等旧值全部过期之后再移除旧密钥
+type EncryptCache struct {
+	Cache
+	currentKeyID string
+	aeads        map[string]cipher.AEAD
+}
+
+// NewEncryptCache keys 为 keyID 到密钥的映射, 密钥长度必须是 16, 24 或者 32 字节
+func NewEncryptCache(cache Cache, currentKeyID string, keys map[string][]byte) (*EncryptCache, error) {
+	if len(currentKeyID) == 0 || len(currentKeyID) > 255 {
+		return nil, fmt.Errorf("cache: keyID 长度必须在 1 到 255 之间, keyID: %s", currentKeyID)
+	}
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("%w, keyID: %s", ErrUnknownEncryptionKey, currentKeyID)
+	}
+	res := &EncryptCache{
+		Cache:        cache,
+		currentKeyID: currentKeyID,
+		aeads:        make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("cache: 无效的密钥 %s, 原因：%w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		res.aeads[id] = aead
+	}
+	return res, nil
+}
+
+func (e *EncryptCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := e.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, val)
+}
+
+func (e *EncryptCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	data, err := BytesCodec{}.Encode(value)
+	if err != nil {
+		return err
+	}
+	data, err = e.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+	return e.Cache.Set(ctx, key, data, expireTime)
+}
+
+func (e *EncryptCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	val, err := e.Cache.LoadAndDelete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, val)
+}
+
+func (e *EncryptCache) encrypt(key string, data []byte) ([]byte, error) {
+	aead := e.aeads[e.currentKeyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	res := make([]byte, 0, 1+len(e.currentKeyID)+len(nonce)+len(data)+aead.Overhead())
+	res = append(res, byte(len(e.currentKeyID)))
+	res = append(res, e.currentKeyID...)
+	res = append(res, nonce...)
+	return aead.Seal(res, nonce, data, []byte(key)), nil
+}
+
+func (e *EncryptCache) decrypt(key string, val any) (any, error) {
+	// RedisCache 没有配置 codec 时返回的是 string
+	data, err := BytesCodec{}.Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, ErrInvalidCiphertext
+	}
+	keyID := string(data[1 : 1+data[0]])
+	data = data[1+len(keyID):]
+	aead, ok := e.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w, keyID: %s", ErrUnknownEncryptionKey, keyID)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	res, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w, 原因：%s", ErrInvalidCiphertext, err.Error())
+	}
+	return res, nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewEncryptCache(t *testing.T) {
+	testCases := []struct {
+		name         string
+		currentKeyID string
+		keys         map[string][]byte
+		wantErr      bool
+	}{
+		{
+			name:         "ok",
+			currentKeyID: "v1",
+			keys:         map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32)},
+		},
+		{
+			name:         "current key not exist",
+			currentKeyID: "v2",
+			keys:         map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32)},
+			wantErr:      true,
+		},
+		{
+			name:         "invalid key size",
+			currentKeyID: "v1",
+			keys:         map[string][]byte{"v1": []byte("short")},
+			wantErr:      true,
+		},
+		{
+			name:         "empty key id",
+			currentKeyID: "",
+			keys:         map[string][]byte{"": bytes.Repeat([]byte{1}, 32)},
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEncryptCache(NewBuildInMapCache(time.Minute), tc.currentKeyID, tc.keys)
+			assert.Equal(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestEncryptCache(t *testing.T) {
+	ctx := context.Background()
+	local := NewBuildInMapCache(time.Minute)
+	keyV1 := bytes.Repeat([]byte{1}, 32)
+	keyV2 := bytes.Repeat([]byte{2}, 16)
+	v1, err := NewEncryptCache(local, "v1", map[string][]byte{"v1": keyV1})
+	require.NoError(t, err)
+
+	require.NoError(t, v1.Set(ctx, "key1", "secret token", time.Minute))
+	raw, err := local.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(raw.([]byte), []byte("secret token")))
+	val, err := v1.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret token"), val)
+
+	// 轮换密钥: v2 加密, v1 依旧可以解密
+	v2, err := NewEncryptCache(local, "v2", map[string][]byte{"v1": keyV1, "v2": keyV2})
+	require.NoError(t, err)
+	val, err = v2.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret token"), val)
+	require.NoError(t, v2.Set(ctx, "key2", []byte("new token"), time.Minute))
+	_, err = v1.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, ErrUnknownEncryptionKey))
+
+	// 密文与 key 绑定, 挪到其它 key 下无法解密
+	require.NoError(t, local.Set(ctx, "key3", raw, time.Minute))
+	_, err = v1.Get(ctx, "key3")
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+
+	require.NoError(t, local.Set(ctx, "key4", []byte{10, 'v'}, time.Minute))
+	_, err = v1.Get(ctx, "key4")
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	val, err = v2.LoadAndDelete(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new token"), val)
+}
@@ -0,0 +1,10 @@
+package cache
+
+import "testing"
+
+// 导出给 cache_test 包中的测试使用
+
+// StartFakeMemcached 启动进程内的 memcached, 返回监听地址
+func StartFakeMemcached(t *testing.T) string {
+	return newFakeMemcached(t).addr()
+}
@@ -0,0 +1,411 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCacheFile = errors.New("cache: 缓存文件格式错误")
+)
+
+const (
+	fileCacheVersion byte = 1
+	// 版本(1) + 过期时间(8) + key 长度(4)
+	fileCacheHeaderSize = 1 + 8 + 4
+	// 临时文件目录和前缀都带有 FileCache 专用的名字, 避免误删用户的文件
+	fileCacheTmpDir    = ".geek_cache_tmp"
+	fileCacheTmpPrefix = "geek_cache-"
+)
+
+// FileCache 基于文件系统的缓存, 适合放不进内存或者 redis 的大对象
+// 文件按照 sha256(key) 分散在两级目录中, 例如 ab/cd/abcd...
+// 内存中只保存索引(大小, 过期时间, LRU 顺序), 总大小超过 maxSize 时淘汰最久未使用的数据
+// 写入时先写临时文件再 rename, 因此进程崩溃不会留下写了一半的文件
+// 启动时扫描目录重建索引, LRU 顺序按照文件的修改时间恢复
+// 只会删除符合 xx/yy/<sha256> 布局的文件和临时文件, 目录中的其它文件不受影响
+// 值必须是 []byte 或者 string, Get 返回 []byte
+type FileCache struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize int64
+	used    int64
+
+	index map[string]*list.Element
+	// 链表头部是最近使用的
+	lru *list.List
+}
+
+type fileEntry struct {
+	key        string
+	path       string
+	size       int64
+	expireTime time.Time
+}
+
+func (e *fileEntry) deadlineBefore(t time.Time) bool {
+	return !e.expireTime.IsZero() && e.expireTime.Before(t)
+}
+
+// NewFileCache maxSize 为所有文件(包括头部)的总大小上限
+func NewFileCache(dir string, maxSize int64) (*FileCache, error) {
+	res := &FileCache{
+		dir:     dir,
+		maxSize: maxSize,
+		index:   map[string]*list.Element{},
+		lru:     list.New(),
+	}
+	if err := res.recover(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Get 读文件的时候不持有锁, 读完之后再确认索引没有变化
+func (f *FileCache) Get(ctx context.Context, key string) (any, error) {
+	f.mutex.Lock()
+	ele, ok := f.index[key]
+	if !ok {
+		f.mutex.Unlock()
+		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	entry := ele.Value.(*fileEntry)
+	if entry.deadlineBefore(time.Now()) {
+		f.remove(ele)
+		f.mutex.Unlock()
+		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	f.mutex.Unlock()
+
+	val, err := readCacheFile(entry.path)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// 读的过程中 key 被覆盖或者删除了, 读到的是旧值或者新值, 都是可以接受的
+	// 但是不能再根据读取的结果修改别人的索引
+	current := f.index[key] == ele
+	if err != nil {
+		// 文件被外部删除或者损坏, 其它错误(例如打开的文件太多)可能只是暂时的, 保留数据
+		if current && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrInvalidCacheFile)) {
+			f.remove(ele)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+		}
+		return nil, err
+	}
+	if current {
+		f.lru.MoveToFront(ele)
+	}
+	return val, nil
+}
+
+// Set 写入并 Sync 临时文件的时候不持有锁, 只有 rename 和更新索引在锁内
+// rename 必须和更新索引一起在锁内完成, 否则并发覆盖同一个 key 时, 索引中的大小和过期时间可能与最终的文件对不上
+func (f *FileCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	data, err := BytesCodec{}.Encode(value)
+	if err != nil {
+		return err
+	}
+	entry := &fileEntry{
+		key:  key,
+		path: f.path(key),
+		size: int64(fileCacheHeaderSize + len(key) + len(data)),
+	}
+	if expireTime > 0 {
+		entry.expireTime = time.Now().Add(expireTime)
+	}
+	if entry.size > f.maxSize {
+		return fmt.Errorf("%w, key: %s, 大小: %d", errs.ErrOverCapacity, key, entry.size)
+	}
+
+	tmp, err := f.writeTemp(entry, data)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// rename 成功之后临时文件已经不存在了
+		_ = os.Remove(tmp)
+	}()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err = os.Rename(tmp, entry.path); err != nil {
+		return err
+	}
+	// 覆盖的时候文件已经被替换了, 只需要移除索引
+	if ele, ok := f.index[key]; ok {
+		f.used -= ele.Value.(*fileEntry).size
+		f.lru.Remove(ele)
+		delete(f.index, key)
+	}
+	f.add(entry)
+	for f.used > f.maxSize {
+		f.remove(f.lru.Back())
+	}
+	return nil
+}
+
+func (f *FileCache) Delete(ctx context.Context, key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if ele, ok := f.index[key]; ok {
+		f.remove(ele)
+	}
+	return nil
+}
+
+func (f *FileCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ele, ok := f.index[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	entry := ele.Value.(*fileEntry)
+	val, err := readCacheFile(entry.path)
+	f.remove(ele)
+	if entry.deadlineBefore(time.Now()) || errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// Size 当前所有文件的总大小
+func (f *FileCache) Size() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.used
+}
+
+func (f *FileCache) add(entry *fileEntry) {
+	f.index[entry.key] = f.lru.PushFront(entry)
+	f.used += entry.size
+}
+
+// remove 删除索引和文件
+func (f *FileCache) remove(ele *list.Element) {
+	entry := ele.Value.(*fileEntry)
+	f.lru.Remove(ele)
+	delete(f.index, entry.key)
+	f.used -= entry.size
+	_ = os.Remove(entry.path)
+}
+
+func (f *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(f.dir, name[:2], name[2:4], name)
+}
+
+// writeTemp 写入临时文件并 Sync, 返回临时文件的路径, 由调用者 rename 到目标位置
+func (f *FileCache) writeTemp(entry *fileEntry, data []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(entry.path), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Join(f.dir, fileCacheTmpDir), fileCacheTmpPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, fileCacheHeaderSize, fileCacheHeaderSize+len(entry.key))
+	buf[0] = fileCacheVersion
+	var expire int64
+	if !entry.expireTime.IsZero() {
+		expire = entry.expireTime.UnixNano()
+	}
+	binary.BigEndian.PutUint64(buf[1:9], uint64(expire))
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(entry.key)))
+	buf = append(buf, entry.key...)
+	if _, err = tmp.Write(buf); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// recover 扫描目录重建索引, 删除过期的文件, 损坏的文件以及残留的临时文件
+func (f *FileCache) recover() error {
+	tmpDir := filepath.Join(f.dir, fileCacheTmpDir)
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return err
+	}
+	tmpFiles, err := filepath.Glob(filepath.Join(tmpDir, fileCacheTmpPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmpFiles {
+		if err = os.Remove(tmp); err != nil {
+			return err
+		}
+	}
+
+	type recovered struct {
+		entry   *fileEntry
+		modTime time.Time
+	}
+	var entries []recovered
+	now := time.Now()
+	err = filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// 只进入 xx 和 xx/yy 两级目录
+			if path != f.dir && !isCacheDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !isCacheFile(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry, err := readCacheFileHeader(path, info.Size())
+		// 文件名与 key 对不上说明不是 FileCache 写入的文件或者已经损坏
+		if err != nil || entry.deadlineBefore(now) || f.path(entry.key) != path {
+			_ = os.Remove(path)
+			return nil
+		}
+		entries = append(entries, recovered{entry: entry, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 先加入旧的, 最新写入的在链表头部
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		f.add(e.entry)
+	}
+	for f.used > f.maxSize {
+		f.remove(f.lru.Back())
+	}
+	return nil
+}
+
+// isCacheDir rel 为 xx 或者 xx/yy, 其中 xx 和 yy 为两位小写十六进制
+func isCacheDir(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) > 2 {
+		return false
+	}
+	for _, part := range parts {
+		if len(part) != 2 || !isLowerHex(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCacheFile rel 为 xx/yy/<sha256>, 并且 xx 和 yy 是文件名的前四位
+func isCacheFile(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 3 {
+		return false
+	}
+	name := parts[2]
+	return len(name) == sha256.Size*2 && isLowerHex(name) &&
+		parts[0] == name[:2] && parts[1] == name[2:4]
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// readCacheFileHeader 只读取头部和 key, 恢复索引时不需要读取整个文件
+func readCacheFileHeader(path string, size int64) (*fileEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, fileCacheHeaderSize)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+	entry, keyLen, err := parseCacheFileHeader(path, header)
+	if err != nil {
+		return nil, err
+	}
+	if int64(fileCacheHeaderSize+keyLen) > size {
+		return nil, ErrInvalidCacheFile
+	}
+	key := make([]byte, keyLen)
+	if _, err = io.ReadFull(file, key); err != nil {
+		return nil, err
+	}
+	entry.key = string(key)
+	entry.size = size
+	return entry, nil
+}
+
+// readCacheFile 读取文件并返回值
+func readCacheFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, keyLen, err := parseCacheFileHeader(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < fileCacheHeaderSize+keyLen {
+		return nil, ErrInvalidCacheFile
+	}
+	return data[fileCacheHeaderSize+keyLen:], nil
+}
+
+func parseCacheFileHeader(path string, header []byte) (*fileEntry, int, error) {
+	if len(header) < fileCacheHeaderSize || header[0] != fileCacheVersion {
+		return nil, 0, ErrInvalidCacheFile
+	}
+	entry := &fileEntry{path: path}
+	if expire := int64(binary.BigEndian.Uint64(header[1:9])); expire > 0 {
+		entry.expireTime = time.Unix(0, expire)
+	}
+	return entry, int(binary.BigEndian.Uint32(header[9:13])), nil
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewFileCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+
+	_, err = c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+
+	// 覆盖之后大小按照新的值计算
+	require.NoError(t, c.Set(ctx, "key1", "v", time.Minute))
+	assert.Equal(t, int64(fileCacheHeaderSize+len("key1")+1), c.Size())
+
+	val, err = c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	_, err = os.Stat(c.path("key1"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, int64(0), c.Size())
+
+	require.NoError(t, c.Set(ctx, "key2", "value2", time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+	_, err = c.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	err = c.Set(ctx, "key3", bytes.Repeat([]byte{1}, 2<<20), time.Minute)
+	assert.True(t, errors.Is(err, errs.ErrOverCapacity))
+}
+
+func TestFileCache_Evict(t *testing.T) {
+	ctx := context.Background()
+	entrySize := int64(fileCacheHeaderSize + len("key0") + 100)
+	c, err := NewFileCache(t.TempDir(), 3*entrySize)
+	require.NoError(t, err)
+	val := bytes.Repeat([]byte{1}, 100)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), val, 0))
+	}
+	// 访问 key0, key1 变成最久未使用的
+	_, err = c.Get(ctx, "key0")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "key3", val, 0))
+
+	_, err = c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	for _, key := range []string{"key0", "key2", "key3"} {
+		_, err = c.Get(ctx, key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3*entrySize, c.Size())
+}
+
+func TestFileCache_ReadError(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewFileCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+
+	// 读取失败但是文件可能还在, 保留索引
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	size := c.Size()
+	path := c.path("key1")
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0o755))
+	_, err = c.Get(ctx, "key1")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.Equal(t, size, c.Size())
+
+	// 文件不存在
+	require.NoError(t, os.Remove(path))
+	_, err = c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.Equal(t, int64(0), c.Size())
+
+	// 文件损坏
+	require.NoError(t, c.Set(ctx, "key2", "value2", time.Minute))
+	require.NoError(t, os.WriteFile(c.path("key2"), []byte("invalid"), 0o644))
+	_, err = c.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, ErrInvalidCacheFile))
+	assert.Equal(t, int64(0), c.Size())
+	_, err = os.Stat(c.path("key2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileCache_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewFileCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val := bytes.Repeat([]byte{byte(i)}, i+1)
+			for j := 0; j < 20; j++ {
+				assert.NoError(t, c.Set(ctx, "key1", val, time.Minute))
+				res, er := c.Get(ctx, "key1")
+				if er != nil {
+					assert.True(t, errors.Is(er, errs.ErrKeyNotFound))
+					continue
+				}
+				// 可能读到别人写入的值, 但是一定是完整的
+				data := res.([]byte)
+				assert.Equal(t, bytes.Repeat(data[:1], int(data[0])+1), data)
+				if j%5 == 0 {
+					assert.NoError(t, c.Delete(ctx, "key1"))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 索引中的大小与最终的文件一致
+	val, err := c.Get(ctx, "key1")
+	if err != nil {
+		assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+		assert.Equal(t, int64(0), c.Size())
+		return
+	}
+	assert.Equal(t, int64(fileCacheHeaderSize+len("key1")+len(val.([]byte))), c.Size())
+}
+
+func TestFileCache_Recover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := NewFileCache(dir, 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, c.Set(ctx, "key2", "value2", 0))
+	require.NoError(t, c.Set(ctx, "expired", "value3", time.Millisecond))
+	size := c.Size()
+	time.Sleep(10 * time.Millisecond)
+
+	// 残留的临时文件以及损坏的文件
+	require.NoError(t, os.WriteFile(filepath.Join(dir, fileCacheTmpDir, fileCacheTmpPrefix+"1"), []byte("tmp"), 0o644))
+	broken := c.path("broken")
+	require.NoError(t, os.MkdirAll(filepath.Dir(broken), 0o755))
+	require.NoError(t, os.WriteFile(broken, []byte("broken"), 0o644))
+	// 不是 FileCache 写入的文件不会被删除
+	others := []string{
+		filepath.Join(dir, "other"),
+		filepath.Join(dir, "tmp", "other"),
+		filepath.Join(dir, fileCacheTmpDir, "other"),
+		filepath.Join(filepath.Dir(broken), "other"),
+	}
+	for _, other := range others {
+		require.NoError(t, os.MkdirAll(filepath.Dir(other), 0o755))
+		require.NoError(t, os.WriteFile(other, []byte("other"), 0o644))
+	}
+
+	c, err = NewFileCache(dir, 1<<20)
+	require.NoError(t, err)
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+	val, err = c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value2"), val)
+	_, err = c.Get(ctx, "expired")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.Equal(t, size-int64(fileCacheHeaderSize+len("expired")+len("value3")), c.Size())
+
+	_, err = os.Stat(broken)
+	assert.True(t, os.IsNotExist(err))
+	for _, other := range others {
+		_, err = os.Stat(other)
+		assert.NoError(t, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, fileCacheTmpDir))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,341 @@
+package cache
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// countMinSketch 使用 depth 个哈希函数, 每个哈希函数对应一行 width 个计数器
+// 估计值取所有行中最小的计数, 只会高估不会低估
+type countMinSketch struct {
+	width    uint32
+	counters [][]uint32
+}
+
+func newCountMinSketch(width, depth int) *countMinSketch {
+	counters := make([][]uint32, depth)
+	for i := range counters {
+		counters[i] = make([]uint32, width)
+	}
+	return &countMinSketch{
+		width:    uint32(width),
+		counters: counters,
+	}
+}
+
+func (c *countMinSketch) add(h1, h2 uint32) {
+	for i, row := range c.counters {
+		row[(h1+uint32(i)*h2)%c.width]++
+	}
+}
+
+func (c *countMinSketch) estimate(h1, h2 uint32) uint32 {
+	var res uint32
+	for i, row := range c.counters {
+		idx := (h1 + uint32(i)*h2) % c.width
+		if i == 0 || row[idx] < res {
+			res = row[idx]
+		}
+	}
+	return res
+}
+
+func (c *countMinSketch) reset() {
+	for _, row := range c.counters {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+}
+
+// sketchHash 双重哈希, 用两个 32 位的值模拟 depth 个哈希函数
+func sketchHash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	// h2 为奇数, 保证每一行的下标不同
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+type HotKey struct {
+	Key   string
+	Count uint64
+}
+
+// HotKeyDetector 滑动窗口内的热点 key 统计
+// 窗口被切分为多个桶, 每个桶是一个 count-min sketch, 过期的桶被清空复用
+// 同时维护一个大小为 k 的小顶堆记录当前访问次数最多的 key
+type HotKeyDetector struct {
+	mutex sync.Mutex
+
+	buckets   []*countMinSketch
+	bucketDur time.Duration
+	// 当前桶对应的时间片
+	current int64
+
+	k   int
+	top *hotKeyHeap
+	now func() time.Time
+}
+
+// NewHotKeyDetector window 为统计窗口, buckets 为窗口切分的桶数, k 为记录的热点 key 数量
+// buckets 小于 1 时按照 1 处理, 每个桶至少 1ns
+func NewHotKeyDetector(window time.Duration, buckets int, k int) *HotKeyDetector {
+	if buckets < 1 {
+		buckets = 1
+	}
+	bucketDur := window / time.Duration(buckets)
+	if bucketDur < 1 {
+		bucketDur = 1
+	}
+	res := &HotKeyDetector{
+		buckets:   make([]*countMinSketch, buckets),
+		bucketDur: bucketDur,
+		k:         k,
+		top:       &hotKeyHeap{index: map[string]int{}},
+		now:       time.Now,
+	}
+	for i := range res.buckets {
+		res.buckets[i] = newCountMinSketch(2048, 4)
+	}
+	res.current = res.now().UnixNano() / int64(res.bucketDur)
+	return res
+}
+
+// Record 记录一次访问, 返回窗口内的估计访问次数
+func (h *HotKeyDetector) Record(key string) uint64 {
+	h1, h2 := sketchHash(key)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.rotate()
+	h.buckets[h.current%int64(len(h.buckets))].add(h1, h2)
+	cnt := h.estimate(h1, h2)
+	h.top.offer(key, cnt, h.k)
+	return cnt
+}
+
+// Count 窗口内的估计访问次数
+func (h *HotKeyDetector) Count(key string) uint64 {
+	h1, h2 := sketchHash(key)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.rotate()
+	return h.estimate(h1, h2)
+}
+
+// TopKeys 访问次数最多的 k 个 key, 按照访问次数降序
+func (h *HotKeyDetector) TopKeys() []HotKey {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.rotate()
+	res := make([]HotKey, 0, len(h.top.keys))
+	for _, k := range h.top.keys {
+		if k.Count > 0 {
+			res = append(res, k)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Count > res[j].Count
+	})
+	return res
+}
+
+func (h *HotKeyDetector) estimate(h1, h2 uint32) uint64 {
+	var res uint64
+	for _, b := range h.buckets {
+		res += uint64(b.estimate(h1, h2))
+	}
+	return res
+}
+
+// rotate 清空已经滑出窗口的桶, 并重新计算堆中 key 的访问次数
+func (h *HotKeyDetector) rotate() {
+	now := h.now().UnixNano() / int64(h.bucketDur)
+	if now == h.current {
+		return
+	}
+	steps := now - h.current
+	if steps > int64(len(h.buckets)) {
+		steps = int64(len(h.buckets))
+	}
+	for i := int64(1); i <= steps; i++ {
+		h.buckets[(h.current+i)%int64(len(h.buckets))].reset()
+	}
+	h.current = now
+	for i := range h.top.keys {
+		h1, h2 := sketchHash(h.top.keys[i].Key)
+		h.top.keys[i].Count = h.estimate(h1, h2)
+	}
+	heap.Init(h.top)
+}
+
+// hotKeyHeap 按照访问次数排序的小顶堆
+type hotKeyHeap struct {
+	keys  []HotKey
+	index map[string]int
+}
+
+func (h *hotKeyHeap) Len() int {
+	return len(h.keys)
+}
+
+func (h *hotKeyHeap) Less(i, j int) bool {
+	return h.keys[i].Count < h.keys[j].Count
+}
+
+func (h *hotKeyHeap) Swap(i, j int) {
+	h.keys[i], h.keys[j] = h.keys[j], h.keys[i]
+	h.index[h.keys[i].Key] = i
+	h.index[h.keys[j].Key] = j
+}
+
+func (h *hotKeyHeap) Push(x any) {
+	k := x.(HotKey)
+	h.index[k.Key] = len(h.keys)
+	h.keys = append(h.keys, k)
+}
+
+func (h *hotKeyHeap) Pop() any {
+	k := h.keys[len(h.keys)-1]
+	h.keys = h.keys[:len(h.keys)-1]
+	delete(h.index, k.Key)
+	return k
+}
+
+// offer 已经在堆中的 key 更新次数, 否则比堆顶大时替换堆顶
+func (h *hotKeyHeap) offer(key string, cnt uint64, k int) {
+	if i, ok := h.index[key]; ok {
+		h.keys[i].Count = cnt
+		heap.Fix(h, i)
+		return
+	}
+	if len(h.keys) < k {
+		heap.Push(h, HotKey{Key: key, Count: cnt})
+		return
+	}
+	if k > 0 && cnt > h.keys[0].Count {
+		delete(h.index, h.keys[0].Key)
+		h.keys[0] = HotKey{Key: key, Count: cnt}
+		h.index[key] = 0
+		heap.Fix(h, 0)
+	}
+}
+
+// HotKeyCache 统计热点 key, 并且可以把热点 key 提升到本地缓存中, 减轻单个 redis 分片的压力
+// 本地缓存只在当前实例的写操作时失效, 其它实例的修改最多在 localExpiration 之后可见,
+// 所以 localExpiration 应该设置得比较短
+type HotKeyCache struct {
+	Cache
+	detector *HotKeyDetector
+
+	// local 为 nil 时只统计不提升
+	local           *BuildInMapCache
+	threshold       uint64
+	localExpiration time.Duration
+
+	// generations 按照 key 的哈希分段的版本号, 写操作使版本号加一
+	// Get 读 remote 之前记下版本号, 提升时版本号变了说明读到的可能是旧值, 放弃提升
+	// 分段是为了不给每个 key 都维护一个版本号, 代价是同一段里的其它 key 的写操作也会让提升失败
+	genMutex    sync.Mutex
+	generations [64]uint64
+}
+
+type HotKeyCacheOption func(h *HotKeyCache)
+
+func WithHotKeyDetector(detector *HotKeyDetector) HotKeyCacheOption {
+	return func(h *HotKeyCache) {
+		h.detector = detector
+	}
+}
+
+// WithHotKeyPromotion 窗口内访问次数不小于 threshold 的 key 被放入 local, 过期时间为 localExpiration
+func WithHotKeyPromotion(local *BuildInMapCache, threshold uint64, localExpiration time.Duration) HotKeyCacheOption {
+	return func(h *HotKeyCache) {
+		h.local = local
+		h.threshold = threshold
+		h.localExpiration = localExpiration
+	}
+}
+
+func NewHotKeyCache(cache Cache, opts ...HotKeyCacheOption) *HotKeyCache {
+	res := &HotKeyCache{
+		Cache: cache,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.detector == nil {
+		res.detector = NewHotKeyDetector(time.Minute, 6, 100)
+	}
+	return res
+}
+
+func (h *HotKeyCache) Get(ctx context.Context, key string) (any, error) {
+	cnt := h.detector.Record(key)
+	if h.local == nil {
+		return h.Cache.Get(ctx, key)
+	}
+	if val, err := h.local.Get(ctx, key); err == nil {
+		return val, nil
+	}
+	idx := h.generationIndex(key)
+	h.genMutex.Lock()
+	gen := h.generations[idx]
+	h.genMutex.Unlock()
+	val, err := h.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if cnt >= h.threshold {
+		// 比较和写入 local 都在锁内, 否则 invalidate 可能发生在两者之间
+		h.genMutex.Lock()
+		if h.generations[idx] == gen {
+			_ = h.local.Set(ctx, key, val, h.localExpiration)
+		}
+		h.genMutex.Unlock()
+	}
+	return val, nil
+}
+
+func (h *HotKeyCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	err := h.Cache.Set(ctx, key, value, expireTime)
+	h.invalidate(ctx, key)
+	return err
+}
+
+func (h *HotKeyCache) Delete(ctx context.Context, key string) error {
+	err := h.Cache.Delete(ctx, key)
+	h.invalidate(ctx, key)
+	return err
+}
+
+func (h *HotKeyCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	val, err := h.Cache.LoadAndDelete(ctx, key)
+	h.invalidate(ctx, key)
+	return val, err
+}
+
+// TopKeys 当前的热点 key
+func (h *HotKeyCache) TopKeys() []HotKey {
+	return h.detector.TopKeys()
+}
+
+// invalidate 先增加版本号再删除 local, 正在进行的 Get 不会再把旧值写回 local
+func (h *HotKeyCache) invalidate(ctx context.Context, key string) {
+	if h.local == nil {
+		return
+	}
+	h.genMutex.Lock()
+	h.generations[h.generationIndex(key)]++
+	h.genMutex.Unlock()
+	_ = h.local.Delete(ctx, key)
+}
+
+func (h *HotKeyCache) generationIndex(key string) int {
+	h1, _ := sketchHash(key)
+	return int(h1 % uint32(len(h.generations)))
+}
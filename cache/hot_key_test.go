@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHotKeyDetector(t *testing.T) {
+	d := NewHotKeyDetector(time.Minute, 6, 3)
+	for i := 0; i < 100; i++ {
+		d.Record("hot1")
+	}
+	for i := 0; i < 50; i++ {
+		d.Record("hot2")
+	}
+	for i := 0; i < 30; i++ {
+		d.Record("hot3")
+	}
+	for i := 0; i < 1000; i++ {
+		d.Record(fmt.Sprintf("cold%d", i))
+	}
+	top := d.TopKeys()
+	require.Len(t, top, 3)
+	assert.Equal(t, "hot1", top[0].Key)
+	assert.Equal(t, "hot2", top[1].Key)
+	assert.Equal(t, "hot3", top[2].Key)
+	// count-min sketch 只会高估
+	assert.GreaterOrEqual(t, top[0].Count, uint64(100))
+	assert.GreaterOrEqual(t, d.Count("hot2"), uint64(50))
+}
+
+func TestHotKeyDetector_Window(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := NewHotKeyDetector(time.Minute, 6, 3)
+	d.now = func() time.Time {
+		return now
+	}
+	d.current = 0
+	for i := 0; i < 10; i++ {
+		d.Record("key1")
+	}
+	// 还在窗口内
+	now = now.Add(50 * time.Second)
+	d.Record("key1")
+	assert.Equal(t, uint64(11), d.Count("key1"))
+	// 第一个桶滑出窗口
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, uint64(1), d.Count("key1"))
+	assert.Equal(t, []HotKey{{Key: "key1", Count: 1}}, d.TopKeys())
+	// 所有桶都滑出窗口
+	now = now.Add(time.Hour)
+	assert.Equal(t, uint64(0), d.Count("key1"))
+	assert.Len(t, d.TopKeys(), 0)
+}
+
+func TestNewHotKeyDetector_Invalid(t *testing.T) {
+	for _, d := range []*HotKeyDetector{
+		NewHotKeyDetector(time.Minute, 0, 3),
+		NewHotKeyDetector(time.Minute, -1, 3),
+		NewHotKeyDetector(time.Nanosecond, 6, 3),
+		NewHotKeyDetector(0, 6, 3),
+	} {
+		assert.GreaterOrEqual(t, d.bucketDur, time.Duration(1))
+		d.Record("key1")
+		assert.LessOrEqual(t, d.Count("key1"), uint64(1))
+	}
+}
+
+func TestHotKeyCache_Promotion(t *testing.T) {
+	ctx := context.Background()
+	remote := &countingCache{Cache: NewBuildInMapCache(time.Minute)}
+	local := NewBuildInMapCache(time.Minute)
+	c := NewHotKeyCache(remote, WithHotKeyPromotion(local, 3, time.Minute))
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+
+	for i := 0; i < 10; i++ {
+		val, err := c.Get(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, "value1", val)
+	}
+	// 前 3 次读远端, 之后命中本地缓存
+	assert.Equal(t, int32(3), remote.gets)
+	assert.Equal(t, "key1", c.TopKeys()[0].Key)
+
+	// 写操作会让本地缓存失效
+	require.NoError(t, c.Set(ctx, "key1", "value2", time.Minute))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+	assert.Equal(t, int32(4), remote.gets)
+
+	require.NoError(t, c.Delete(ctx, "key1"))
+	_, err = local.Get(ctx, "key1")
+	assert.Error(t, err)
+}
+
+// countingCache 统计 Get 次数
+type countingCache struct {
+	Cache
+	gets int32
+}
+
+func (c *countingCache) Get(ctx context.Context, key string) (any, error) {
+	atomic.AddInt32(&c.gets, 1)
+	return c.Cache.Get(ctx, key)
+}
+
+func TestHotKeyCache_PromotionRace(t *testing.T) {
+	ctx := context.Background()
+	reading := make(chan struct{})
+	proceed := make(chan struct{})
+	remote := &blockingGetCache{Cache: NewBuildInMapCache(time.Minute), reading: reading, proceed: proceed}
+	local := NewBuildInMapCache(time.Minute)
+	c := NewHotKeyCache(remote, WithHotKeyPromotion(local, 1, time.Minute))
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+
+	done := make(chan any)
+	go func() {
+		val, err := c.Get(ctx, "key1")
+		assert.NoError(t, err)
+		done <- val
+	}()
+	// Get 已经读到了旧值, 还没有提升
+	<-reading
+	require.NoError(t, c.Set(ctx, "key1", "value2", time.Minute))
+	close(proceed)
+	assert.Equal(t, "value1", <-done)
+
+	// 旧值没有被写回 local
+	_, err := local.Get(ctx, "key1")
+	assert.Error(t, err)
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+}
+
+// blockingGetCache Get 读到值之后通知 reading, 等待 proceed 关闭之后再返回
+type blockingGetCache struct {
+	Cache
+	once    sync.Once
+	reading chan struct{}
+	proceed chan struct{}
+}
+
+func (c *blockingGetCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := c.Cache.Get(ctx, key)
+	c.once.Do(func() {
+		close(c.reading)
+		<-c.proceed
+	})
+	return val, err
+}
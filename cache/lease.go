@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// 租约(lease), 参考 memcache 在 Scaling Memcache at Facebook 中的做法:
+// 未命中时缓存发放一个租约, 加载完成之后只有带着有效租约的 SetWithLease 才能写入
+// Delete 和 LoadAndDelete 会使未完成的租约失效, 因此在 Delete 之前读取数据库得到的旧值不会覆盖在 Delete 之后写回缓存,
+// 避免 "读未命中 -> 读数据库 -> 更新数据库并删除缓存 -> 写回旧值" 导致的长时间不一致
+// 只有 Delete 和 LoadAndDelete 会使租约失效, 所以更新数据库之后应该删除缓存而不是使用 Set 写入
+
+var (
+	ErrLeaseInvalid = errors.New("cache: 租约已经失效")
+
+	//go:embed lua/lease_get.lua
+	leaseGetLua string
+	//go:embed lua/lease_set.lua
+	leaseSetLua string
+)
+
+// LeaseCache 支持租约的缓存
+type LeaseCache interface {
+	Cache
+	// GetLease 命中时返回值, 未命中时返回租约以及 errs.ErrKeyNotFound
+	// 租约在 leaseExpiration 之后过期, 过期之前同一个 key 未命中时返回同一个租约
+	GetLease(ctx context.Context, key string, leaseExpiration time.Duration) (any, string, error)
+	// SetWithLease 租约已经失效(被删除, 过期或者已经使用过)时返回 ErrLeaseInvalid
+	SetWithLease(ctx context.Context, key string, value any, expireTime time.Duration, lease string) error
+}
+
+type lease struct {
+	token      string
+	expireTime time.Time
+}
+
+func (l *BuildInMapCache) GetLease(ctx context.Context, key string, leaseExpiration time.Duration) (any, string, error) {
+	val, err := l.Get(ctx, key)
+	if err == nil || !errors.Is(err, errs.ErrKeyNotFound) {
+		return val, "", err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// 加锁之前可能已经被其它 goroutine 写入
+	now := time.Now()
+	if v, ok := l.m[key]; ok && !v.deadlineBefore(now) {
+		return v.value, "", nil
+	}
+	if ls, ok := l.leases[key]; ok && ls.expireTime.After(now) {
+		return nil, ls.token, err
+	}
+	ls := &lease{
+		token:      uuid.New().String(),
+		expireTime: now.Add(leaseExpiration),
+	}
+	l.leases[key] = ls
+	return nil, ls.token, err
+}
+
+func (l *BuildInMapCache) SetWithLease(ctx context.Context, key string, value any, expireTime time.Duration, lease string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ls, ok := l.leases[key]
+	if !ok || ls.token != lease || !ls.expireTime.After(time.Now()) {
+		return fmt.Errorf("%w, key: %s", ErrLeaseInvalid, key)
+	}
+	delete(l.leases, key)
+	return l.set(ctx, key, value, expireTime)
+}
+
+func (r *RedisCache) GetLease(ctx context.Context, key string, leaseExpiration time.Duration) (any, string, error) {
+	res, err := r.client.Eval(ctx, leaseGetLua, []string{key, leaseKey(key)},
+		uuid.New().String(), leaseExpiration.Milliseconds()).Slice()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(res) != 2 {
+		return nil, "", fmt.Errorf("cache: 租约脚本返回值格式错误 %v", res)
+	}
+	hit, _ := res[0].(int64)
+	str, _ := res[1].(string)
+	if hit != 1 {
+		return nil, str, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	if r.codec != nil {
+		return []byte(str), "", nil
+	}
+	return str, "", nil
+}
+
+func (r *RedisCache) SetWithLease(ctx context.Context, key string, value any, expireTime time.Duration, lease string) error {
+	if r.codec != nil {
+		data, err := r.codec.Encode(value)
+		if err != nil {
+			return err
+		}
+		value = data
+	}
+	keys := []string{key, leaseKey(key)}
+	if r.versioning {
+		keys = append(keys, versionKey(key))
+	}
+	res, err := r.client.Eval(ctx, leaseSetLua, keys,
+		lease, value, expireTime.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return fmt.Errorf("%w, key: %s", ErrLeaseInvalid, key)
+	}
+	return nil
+}
+
+// leaseKey 租约保存在单独的 key 中
+func leaseKey(key string) string {
+	return companionKey(key, ":lease")
+}
+
+// companionKey 与 key 落在同一个 slot 的辅助 key, 集群模式下 lua 脚本和 DEL 才能同时操作它们
+// key 本身带有 hash tag 时直接追加后缀, 否则把整个 key 作为 hash tag
+// key 没有 hash tag 但是包含 } 时(例如 a{}b), tag 会在 key 中的 } 处截断, 不能把整个 key 作为 tag,
+// 这时使用 slotTag 找到一个与整个 key 落在同一个 slot 的 tag
+func companionKey(key string, suffix string) string {
+	if _, ok := hashTagOf(key); ok {
+		return key + suffix
+	}
+	if strings.IndexByte(key, '}') > -1 {
+		return HashTag(slotTag(KeySlot(key)), key+suffix)
+	}
+	return HashTag(key, suffix)
+}
@@ -0,0 +1,49 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisCache_Lease_e2e(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := NewRedisCache(client)
+	require.NoError(t, c.Delete(ctx, "lease-key"))
+	defer c.Delete(ctx, "lease-key")
+
+	_, oldLease, err := c.GetLease(ctx, "lease-key", time.Minute)
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	_, lease, _ := c.GetLease(ctx, "lease-key", time.Minute)
+	assert.Equal(t, oldLease, lease)
+
+	// Delete 之后旧的租约不能再写入
+	require.NoError(t, c.Delete(ctx, "lease-key"))
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "lease-key", "old", time.Minute, oldLease), ErrLeaseInvalid))
+
+	_, newLease, _ := c.GetLease(ctx, "lease-key", time.Minute)
+	require.NoError(t, c.SetWithLease(ctx, "lease-key", "new", time.Minute, newLease))
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "lease-key", "new", time.Minute, newLease), ErrLeaseInvalid))
+	val, lease, err := c.GetLease(ctx, "lease-key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "new", val)
+	assert.Empty(t, lease)
+
+	// LoadAndDelete 同样使租约失效
+	require.NoError(t, c.Delete(ctx, "lease-key"))
+	_, oldLease, _ = c.GetLease(ctx, "lease-key", time.Minute)
+	_, err = c.LoadAndDelete(ctx, "lease-key")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "lease-key", "old", time.Minute, oldLease), ErrLeaseInvalid))
+}
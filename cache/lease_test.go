@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLeaseKey(t *testing.T) {
+	for _, key := range []string{"key1", "user:1", "{user1}name", "a{b}c"} {
+		lk := leaseKey(key)
+		assert.NotEqual(t, key, lk)
+		assert.Equal(t, KeySlot(key), KeySlot(lk), key)
+	}
+}
+
+func TestCompanionKey(t *testing.T) {
+	// 包含 { 或者 } 但是没有有效 hash tag 的 key, 整个 key 参与计算 slot
+	keys := []string{"key1", "{user1}name", "a{}b", "a}b{c", "a{b", "a}b", "{}", "}{a}", "{{a}}"}
+	for _, key := range keys {
+		for _, suffix := range []string{":lease", ":version"} {
+			ck := companionKey(key, suffix)
+			assert.NotEqual(t, key, ck)
+			assert.Equal(t, KeySlot(key), KeySlot(ck), "key: %s, companion: %s", key, ck)
+		}
+	}
+	assert.NotEqual(t, companionKey("a{}b", ":lease"), companionKey("a{}c", ":lease"))
+}
+
+func TestBuildInMapCache_Lease(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	_, lease1, err := c.GetLease(ctx, "key1", time.Minute)
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	require.NotEmpty(t, lease1)
+	// 租约没有过期之前返回同一个租约
+	_, lease2, err := c.GetLease(ctx, "key1", time.Minute)
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.Equal(t, lease1, lease2)
+
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "key1", "value1", time.Minute, "other"), ErrLeaseInvalid))
+	require.NoError(t, c.SetWithLease(ctx, "key1", "value1", time.Minute, lease1))
+	// 租约只能使用一次
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "key1", "value2", time.Minute, lease1), ErrLeaseInvalid))
+
+	val, lease, err := c.GetLease(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Empty(t, lease)
+}
+
+func TestBuildInMapCache_LeaseInvalidatedByDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	// 读取数据库之后, 写回缓存之前数据被更新
+	_, oldLease, _ := c.GetLease(ctx, "key1", time.Minute)
+	require.NoError(t, c.Delete(ctx, "key1"))
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "key1", "old", time.Minute, oldLease), ErrLeaseInvalid))
+	_, err := c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	_, newLease, _ := c.GetLease(ctx, "key1", time.Minute)
+	assert.NotEqual(t, oldLease, newLease)
+	require.NoError(t, c.SetWithLease(ctx, "key1", "new", time.Minute, newLease))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "new", val)
+}
+
+func TestBuildInMapCache_LeaseInvalidatedByLoadAndDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	_, oldLease, _ := c.GetLease(ctx, "key1", time.Minute)
+	// key 不存在时同样使租约失效
+	_, err := c.LoadAndDelete(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "key1", "old", time.Minute, oldLease), ErrLeaseInvalid))
+}
+
+func TestBuildInMapCache_LeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(10 * time.Millisecond)
+	defer c.Close()
+
+	_, lease1, _ := c.GetLease(ctx, "key1", 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, errors.Is(c.SetWithLease(ctx, "key1", "value1", time.Minute, lease1), ErrLeaseInvalid))
+	c.mutex.RLock()
+	assert.Empty(t, c.leases)
+	c.mutex.RUnlock()
+
+	_, lease2, _ := c.GetLease(ctx, "key1", time.Minute)
+	assert.NotEqual(t, lease1, lease2)
+}
+
+func TestRedisCache_GetLease(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name      string
+		result    []any
+		err       error
+		wantVal   any
+		wantLease string
+		wantErr   error
+	}{
+		{
+			name:    "hit",
+			result:  []any{int64(1), "value1"},
+			wantVal: "value1",
+		},
+		{
+			name:      "miss",
+			result:    []any{int64(0), "lease1"},
+			wantLease: "lease1",
+			wantErr:   errs.ErrKeyNotFound,
+		},
+		{
+			name:    "eval error",
+			err:     context.DeadlineExceeded,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(ctx)
+			if tc.err != nil {
+				res.SetErr(tc.err)
+			} else {
+				res.SetVal(tc.result)
+			}
+			cmd.EXPECT().Eval(ctx, leaseGetLua, []string{"key1", "{key1}:lease"}, gomock.Any(), int64(1000)).
+				Return(res)
+			val, lease, err := NewRedisCache(cmd).GetLease(ctx, "key1", time.Second)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantVal, val)
+			assert.Equal(t, tc.wantLease, lease)
+		})
+	}
+}
+
+func TestRedisCache_SetWithLease(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		result  int64
+		wantErr error
+	}{
+		{
+			name:   "set",
+			result: 1,
+		},
+		{
+			name:    "stale lease",
+			result:  0,
+			wantErr: ErrLeaseInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(ctx)
+			res.SetVal(tc.result)
+			cmd.EXPECT().Eval(ctx, leaseSetLua, []string{"key1", "{key1}:lease"}, "lease1", "value1", int64(60000)).
+				Return(res)
+			err := NewRedisCache(cmd).SetWithLease(ctx, "key1", "value1", time.Minute, "lease1")
+			assert.True(t, errors.Is(err, tc.wantErr))
+		})
+	}
+}
+
+func TestRedisCache_LoadAndDelete(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		result  any
+		err     error
+		opts    []RedisCacheOption
+		wantVal any
+		wantErr error
+	}{
+		{
+			name:    "hit",
+			result:  "value1",
+			wantVal: "value1",
+		},
+		{
+			name:    "codec",
+			result:  "value1",
+			opts:    []RedisCacheOption{WithCodec(JSONCodec{})},
+			wantVal: []byte("value1"),
+		},
+		{
+			name:    "miss",
+			err:     redis.Nil,
+			wantErr: errs.ErrKeyNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(ctx)
+			if tc.err != nil {
+				res.SetErr(tc.err)
+			} else {
+				res.SetVal(tc.result)
+			}
+			// 同时删除租约
+			cmd.EXPECT().Eval(ctx, getDelLua, []string{"key1", "{key1}:lease"}).Return(res)
+			val, err := NewRedisCache(cmd, tc.opts...).LoadAndDelete(ctx, "key1")
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+}
@@ -13,6 +13,8 @@ import (
 type item struct {
 	value      any
 	expireTime time.Time
+	// version 每次写入加一, 见 GetWithVersion
+	version uint64
 }
 
 func (i *item) deadlineBefore(t time.Time) bool {
@@ -23,6 +25,8 @@ type BuildInMapCache struct {
 	mutex sync.RWMutex
 	m     map[string]*item
 	close chan struct{}
+	// leases 未命中时发放的租约, 见 GetLease
+	leases map[string]*lease
 
 	// CDC(change data capture)实现: 一个key被更新后进行通知或者操作一些事情
 	onEvicted func(key string, value any)
@@ -39,8 +43,9 @@ func WithOnEvicted(fn func(key string, val any)) BuildInMapCacheOption {
 
 func NewBuildInMapCache(interval time.Duration, opts ...BuildInMapCacheOption) *BuildInMapCache {
 	res := &BuildInMapCache{
-		m:     map[string]*item{},
-		close: make(chan struct{}),
+		m:      map[string]*item{},
+		close:  make(chan struct{}),
+		leases: map[string]*lease{},
 		onEvicted: func(key string, value any) {
 
 		},
@@ -66,6 +71,12 @@ func NewBuildInMapCache(interval time.Duration, opts ...BuildInMapCacheOption) *
 					}
 					i++
 				}
+				// 没有被使用的租约也需要清理
+				for key, ls := range res.leases {
+					if !ls.expireTime.After(t) {
+						delete(res.leases, key)
+					}
+				}
 				res.mutex.Unlock()
 			case <-res.close:
 				return
@@ -115,9 +126,13 @@ func (l *BuildInMapCache) Set(ctx context.Context, key string, value any, expire
 }
 
 func (l *BuildInMapCache) set(ctx context.Context, key string, value any, expireTime time.Duration) error {
-	i := &item{value: value}
+	now := time.Now()
+	i := &item{value: value, version: 1}
+	if old, ok := l.m[key]; ok && !old.deadlineBefore(now) {
+		i.version = old.version + 1
+	}
 	if expireTime > 0 {
-		i.expireTime = time.Now().Add(expireTime)
+		i.expireTime = now.Add(expireTime)
 	}
 	l.m[key] = i
 	return nil
@@ -126,6 +141,8 @@ func (l *BuildInMapCache) set(ctx context.Context, key string, value any, expire
 func (l *BuildInMapCache) Delete(ctx context.Context, key string) error {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
+	// key 不存在时同样需要使租约失效, 正在加载的旧值不能再写入
+	delete(l.leases, key)
 	l.delete(key)
 	return nil
 }
@@ -133,11 +150,17 @@ func (l *BuildInMapCache) Delete(ctx context.Context, key string) error {
 func (l *BuildInMapCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
+	// 与 Delete 一样使租约失效
+	delete(l.leases, key)
 	v, ok := l.m[key]
 	if !ok {
 		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
 	}
 	l.delete(key)
+	// 已经过期的数据同样视为不存在
+	if v.deadlineBefore(time.Now()) {
+		return nil, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
 	return v.value, nil
 }
 
@@ -0,0 +1,5 @@
+-- KEYS[1] 位数组, ARGV 为需要置 1 的所有位
+for i = 1, #ARGV do
+    redis.call('setbit', KEYS[1], ARGV[i], 1)
+end
+return 1
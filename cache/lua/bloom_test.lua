@@ -0,0 +1,7 @@
+-- KEYS[1] 位数组, ARGV 为需要检查的所有位, 全部为 1 时返回 1
+for i = 1, #ARGV do
+    if redis.call('getbit', KEYS[1], ARGV[i]) == 0 then
+        return 0
+    end
+end
+return 1
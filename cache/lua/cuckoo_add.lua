@@ -0,0 +1,63 @@
+-- KEYS[1] 桶(字符串, 第 i 个桶的第 s 个槽位为 BITFIELD u16 #(i*4+s), 0 表示空槽位)
+-- ARGV[1] 桶的数量, ARGV[2] 指纹, ARGV[3] 第一个候选桶, ARGV[4] 最大踢出次数
+-- 返回 1 表示插入成功, 0 表示过滤器已满
+local n = tonumber(ARGV[1])
+local fp = tonumber(ARGV[2])
+local i1 = tonumber(ARGV[3])
+local maxKicks = tonumber(ARGV[4])
+
+-- 另一个候选桶, 与客户端的 cuckooAltIndex 保持一致
+local function alt(i, f)
+    return (f * 1540483477 - i) % n
+end
+
+local function get(slot)
+    return redis.call('bitfield', KEYS[1], 'get', 'u16', '#' .. slot)[1]
+end
+
+local function set(slot, f)
+    redis.call('bitfield', KEYS[1], 'set', 'u16', '#' .. slot, f)
+end
+
+local function tryInsert(i, f)
+    local b = i * 4
+    local slots = redis.call('bitfield', KEYS[1],
+        'get', 'u16', '#' .. b, 'get', 'u16', '#' .. (b + 1),
+        'get', 'u16', '#' .. (b + 2), 'get', 'u16', '#' .. (b + 3))
+    for s = 1, 4 do
+        if slots[s] == 0 then
+            set(b + s - 1, f)
+            return true
+        end
+    end
+    return false
+end
+
+if tryInsert(i1, fp) then
+    return 1
+end
+local i = alt(i1, fp)
+if tryInsert(i, fp) then
+    return 1
+end
+
+-- 两个候选桶都满了, 随机踢出一个指纹并放到它的另一个候选桶
+local path = {}
+local f = fp
+for k = 1, maxKicks do
+    local slot = i * 4 + math.random(0, 3)
+    local old = get(slot)
+    set(slot, f)
+    path[#path + 1] = { slot, old }
+    f = old
+    i = alt(i, f)
+    if tryInsert(i, f) then
+        return 1
+    end
+end
+
+-- 插入失败, 按照相反的顺序恢复被踢出的指纹, 不能丢失已经存在的元素
+for k = #path, 1, -1 do
+    set(path[k][1], path[k][2])
+end
+return 0
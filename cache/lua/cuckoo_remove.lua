@@ -0,0 +1,11 @@
+-- KEYS[1] 桶, ARGV[1] 指纹, ARGV[2..] 两个候选桶的所有槽位
+-- 删除一个匹配的指纹, 返回 1 表示删除成功, 0 表示不存在
+local fp = tonumber(ARGV[1])
+for k = 2, #ARGV do
+    local slot = '#' .. ARGV[k]
+    if redis.call('bitfield', KEYS[1], 'get', 'u16', slot)[1] == fp then
+        redis.call('bitfield', KEYS[1], 'set', 'u16', slot, 0)
+        return 1
+    end
+end
+return 0
@@ -0,0 +1,45 @@
+-- KEYS[1] 锁, KEYS[2] 等待队列(list, 按照到达顺序), KEYS[3] 等待者的超时时间(zset, score 为超时的时间点)
+-- ARGV[1] 标识, ARGV[2] 锁的过期时间(毫秒), ARGV[3] 等待者的超时时间(毫秒)
+-- 加锁成功返回 1, 否则排队并返回 0. 等待者每次轮询都会延长自己的超时时间, 超时说明已经放弃
+redis.replicate_commands()
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+-- 从队头开始清理已经放弃的等待者, 队列中间的等待者在到达队头时再清理
+while true do
+    local first = redis.call('lindex', KEYS[2], 0)
+    if not first then
+        break
+    end
+    local deadline = redis.call('zscore', KEYS[3], first)
+    if deadline and tonumber(deadline) > now then
+        break
+    end
+    redis.call('lpop', KEYS[2])
+    redis.call('zrem', KEYS[3], first)
+end
+
+local owner = redis.call('get', KEYS[1])
+if owner == ARGV[1] then
+    -- 上一次加锁的响应丢失之后重试
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    return 1
+end
+local first = redis.call('lindex', KEYS[2], 0)
+if not owner and (not first or first == ARGV[1]) then
+    redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+    if first then
+        redis.call('lpop', KEYS[2])
+        redis.call('zrem', KEYS[3], ARGV[1])
+    end
+    return 1
+end
+
+if not redis.call('zscore', KEYS[3], ARGV[1]) then
+    redis.call('rpush', KEYS[2], ARGV[1])
+end
+redis.call('zadd', KEYS[3], now + tonumber(ARGV[3]), ARGV[1])
+-- 所有等待者都放弃之后队列自动删除
+redis.call('pexpire', KEYS[2], ARGV[3])
+redis.call('pexpire', KEYS[3], ARGV[3])
+return 0
@@ -0,0 +1,3 @@
+-- KEYS[1] 等待队列, KEYS[2] 等待者的超时时间, ARGV[1] 标识
+redis.call('lrem', KEYS[1], 0, ARGV[1])
+return redis.call('zrem', KEYS[2], ARGV[1])
@@ -0,0 +1,17 @@
+-- KEYS[1] 窗口计数器, ARGV[1] 窗口长度(毫秒), ARGV[2] 窗口内允许的请求数
+-- 返回 {是否允许, 需要等待的毫秒数}
+local cnt = redis.call('incr', KEYS[1])
+if cnt == 1 then
+    -- 窗口从第一个请求开始
+    redis.call('pexpire', KEYS[1], ARGV[1])
+end
+if cnt <= tonumber(ARGV[2]) then
+    return {1, 0}
+end
+local ttl = redis.call('pttl', KEYS[1])
+if ttl < 0 then
+    -- 设置过期时间之前出现了异常, 避免计数器永不过期
+    redis.call('pexpire', KEYS[1], ARGV[1])
+    ttl = tonumber(ARGV[1])
+end
+return {0, ttl}
@@ -0,0 +1,5 @@
+-- KEYS[1] key, KEYS[2] 租约, KEYS[3] 版本号(开启版本号时)
+-- 读取并删除 key, 同时使租约失效并删除版本号, key 不存在时返回 false
+local val = redis.call('get', KEYS[1])
+redis.call('del', unpack(KEYS))
+return val
@@ -0,0 +1,7 @@
+-- KEYS[1] 缓存的 key
+-- 返回 {值, 剩余过期时间(毫秒)}, 永不过期时剩余过期时间为 -1, key 不存在时返回 nil
+local val = redis.call('get', KEYS[1])
+if not val then
+    return false
+end
+return {val, redis.call('pttl', KEYS[1])}
@@ -0,0 +1,13 @@
+-- KEYS[1] 缓存的 key, KEYS[2] 租约的 key
+-- ARGV[1] 新的租约, ARGV[2] 租约的有效期(毫秒)
+-- 命中时返回 {1, 值}, 未命中时返回 {0, 租约}, 已经有未过期的租约时返回同一个租约
+local val = redis.call('get', KEYS[1])
+if val then
+    return {1, val}
+end
+local token = redis.call('get', KEYS[2])
+if not token then
+    token = ARGV[1]
+    redis.call('set', KEYS[2], token, 'px', ARGV[2])
+end
+return {0, token}
@@ -0,0 +1,24 @@
+-- KEYS[1] 缓存的 key, KEYS[2] 租约的 key, KEYS[3] 版本号的 key, 没有开启版本号时没有 KEYS[3]
+-- ARGV[1] 租约, ARGV[2] 值, ARGV[3] 过期时间(毫秒), 0 表示永不过期
+-- 租约已经失效(被删除, 过期或者已经使用过)时返回 0
+if redis.call('get', KEYS[2]) ~= ARGV[1] then
+    return 0
+end
+redis.call('del', KEYS[2])
+-- 与 version_set.lua 一样, 每次写入版本号加一
+local ver = 1
+if KEYS[3] and redis.call('exists', KEYS[1]) == 1 then
+    ver = (tonumber(redis.call('get', KEYS[3])) or 0) + 1
+end
+if tonumber(ARGV[3]) > 0 then
+    redis.call('set', KEYS[1], ARGV[2], 'px', ARGV[3])
+    if KEYS[3] then
+        redis.call('set', KEYS[3], ver, 'px', ARGV[3])
+    end
+else
+    redis.call('set', KEYS[1], ARGV[2])
+    if KEYS[3] then
+        redis.call('set', KEYS[3], ver)
+    end
+end
+return 1
@@ -0,0 +1,22 @@
+-- KEYS[1] 锁, 使用 hash 保存持有者(owner), 重入次数(count)以及最近一次加锁的标识(attempt)
+-- ARGV[1] 持有者, ARGV[2] 过期时间(毫秒), ARGV[3] 本次加锁的标识, 同一次 Lock 的重试使用同一个标识
+-- 加锁成功返回重入次数, 锁被别人持有时返回 0
+-- 超时之后重试时上一次可能已经执行成功, 标识相同说明是重复执行, 只续期, 不再增加重入次数
+local owner = redis.call('hget', KEYS[1], 'owner')
+if owner == false then
+    redis.call('hset', KEYS[1], 'owner', ARGV[1], 'count', 1, 'attempt', ARGV[3])
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    return 1
+elseif owner == ARGV[1] then
+    local count
+    if redis.call('hget', KEYS[1], 'attempt') == ARGV[3] then
+        count = tonumber(redis.call('hget', KEYS[1], 'count'))
+    else
+        count = redis.call('hincrby', KEYS[1], 'count', 1)
+        redis.call('hset', KEYS[1], 'attempt', ARGV[3])
+    end
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    return count
+else
+    return 0
+end
@@ -0,0 +1,6 @@
+-- KEYS[1] 锁, ARGV[1] 持有者, ARGV[2] 过期时间(毫秒)
+if redis.call('hget', KEYS[1], 'owner') == ARGV[1] then
+    return redis.call('pexpire', KEYS[1], ARGV[2])
+else
+    return 0
+end
@@ -0,0 +1,11 @@
+-- KEYS[1] 锁, ARGV[1] 持有者
+-- 返回剩余的重入次数, 0 表示锁已经释放, 没有持有锁时返回 -1
+if redis.call('hget', KEYS[1], 'owner') ~= ARGV[1] then
+    return -1
+end
+local count = redis.call('hincrby', KEYS[1], 'count', -1)
+if count <= 0 then
+    redis.call('del', KEYS[1])
+    return 0
+end
+return count
@@ -0,0 +1,7 @@
+-- KEYS[1] 锁, ARGV[1] 持有者, ARGV[2] 过期时间(毫秒)
+-- 与 refresh.lua 一样只有持有者才能续期, 使用毫秒避免不足一秒的过期时间被截断
+if redis.call('get', KEYS[1]) == ARGV[1] then
+    return redis.call('pexpire', KEYS[1], ARGV[2])
+else
+    return 0
+end
@@ -0,0 +1,26 @@
+-- KEYS[1] 写锁, KEYS[2] 读锁(zset), KEYS[3] 等待中的写者
+-- ARGV[1] 写者标识, ARGV[2] 过期时间(毫秒)
+-- 加锁成功返回 1, 否则返回 0, 并在没有其它写者等待时把自己登记为等待中的写者, 之后新的读者无法加锁
+redis.replicate_commands()
+-- 已经持有写锁, 说明上一次加锁已经成功但是客户端超时了, 重试时只续期
+if redis.call('get', KEYS[1]) == ARGV[1] then
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    return 1
+end
+local waiting = redis.call('get', KEYS[3])
+if waiting and waiting ~= ARGV[1] then
+    return 0
+end
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('zremrangebyscore', KEYS[2], '-inf', now)
+if redis.call('exists', KEYS[1]) == 1 or redis.call('zcard', KEYS[2]) > 0 then
+    -- 等待标记同样会过期, 等待中的写者崩溃之后读者最多被阻塞一个过期时间
+    redis.call('set', KEYS[3], ARGV[1], 'px', ARGV[2])
+    return 0
+end
+redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+if waiting then
+    redis.call('del', KEYS[3])
+end
+return 1
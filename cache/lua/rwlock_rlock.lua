@@ -0,0 +1,18 @@
+-- KEYS[1] 写锁, KEYS[2] 读锁(zset, member 为读者标识, score 为过期时间), KEYS[3] 等待中的写者
+-- ARGV[1] 读者标识, ARGV[2] 过期时间(毫秒)
+-- 加锁成功返回 1. 有写者持有锁或者正在等待时返回 0, 保证写者不会被源源不断的读者饿死
+redis.replicate_commands()
+if redis.call('exists', KEYS[1]) == 1 or redis.call('exists', KEYS[3]) == 1 then
+    return 0
+end
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local expiration = tonumber(ARGV[2])
+-- 删除已经过期的读者
+redis.call('zremrangebyscore', KEYS[2], '-inf', now)
+redis.call('zadd', KEYS[2], now + expiration, ARGV[1])
+-- zset 本身的过期时间不能短于任何一个读者
+if redis.call('pttl', KEYS[2]) < expiration then
+    redis.call('pexpire', KEYS[2], expiration)
+end
+return 1
@@ -0,0 +1,15 @@
+-- KEYS[1] 读锁, ARGV[1] 读者标识, ARGV[2] 过期时间(毫秒)
+-- 续期成功返回 1, 没有持有读锁(或者已经过期)时返回 0
+redis.replicate_commands()
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local expiration = tonumber(ARGV[2])
+local score = redis.call('zscore', KEYS[1], ARGV[1])
+if not score or tonumber(score) <= now then
+    return 0
+end
+redis.call('zadd', KEYS[1], 'xx', now + expiration, ARGV[1])
+if redis.call('pttl', KEYS[1]) < expiration then
+    redis.call('pexpire', KEYS[1], expiration)
+end
+return 1
@@ -0,0 +1,14 @@
+-- KEYS[1] 读锁, ARGV[1] 读者标识
+-- 释放成功返回 1, 没有持有读锁(或者已经过期)时返回 0
+redis.replicate_commands()
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local score = redis.call('zscore', KEYS[1], ARGV[1])
+if not score then
+    return 0
+end
+redis.call('zrem', KEYS[1], ARGV[1])
+if tonumber(score) <= now then
+    return 0
+end
+return 1
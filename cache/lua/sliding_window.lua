@@ -0,0 +1,18 @@
+-- KEYS[1] 请求日志(zset, score 为请求时间), ARGV[1] 窗口长度(毫秒), ARGV[2] 窗口内允许的请求数, ARGV[3] 本次请求的唯一标识
+-- 返回 {是否允许, 需要等待的毫秒数}
+redis.replicate_commands()
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+-- 删除滑出窗口的请求
+redis.call('zremrangebyscore', KEYS[1], '-inf', now - window)
+if redis.call('zcard', KEYS[1]) < limit then
+    redis.call('zadd', KEYS[1], now, ARGV[3])
+    redis.call('pexpire', KEYS[1], window)
+    return {1, 0}
+end
+-- 等到最早的请求滑出窗口
+local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+return {0, tonumber(oldest[2]) + window - now}
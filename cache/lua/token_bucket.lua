@@ -0,0 +1,33 @@
+-- KEYS[1] 令牌桶, ARGV[1] 每秒生成的令牌数, ARGV[2] 桶容量
+-- 返回 {是否允许, 需要等待的毫秒数}
+redis.replicate_commands()
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local bucket = redis.call('hmget', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+    -- 桶不存在, 初始为满
+    tokens = burst
+    ts = now
+end
+-- 按照流逝的时间补充令牌
+if now > ts then
+    tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('hset', KEYS[1], 'tokens', tokens, 'ts', now)
+-- 桶补满之后就不需要保存了
+redis.call('pexpire', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
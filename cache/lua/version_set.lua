@@ -0,0 +1,21 @@
+-- KEYS[1] 缓存的 key, 值保存为普通的字符串, 与 Get/Set 兼容, KEYS[2] 版本号的 key
+-- ARGV[1] 期望的版本号, 0 表示 key 不存在, -1 表示不检查版本号(普通的 Set)
+-- ARGV[2] 值, ARGV[3] 过期时间(毫秒), 0 表示永不过期
+-- 版本号不一致时返回 0, 否则返回新的版本号
+local cur = 0
+-- 值过期之后版本号从头开始, 没有版本号的 key(例如引入版本号之前写入的)视为 0
+if redis.call('exists', KEYS[1]) == 1 then
+    cur = tonumber(redis.call('get', KEYS[2])) or 0
+end
+local expected = tonumber(ARGV[1])
+if expected >= 0 and cur ~= expected then
+    return 0
+end
+if tonumber(ARGV[3]) > 0 then
+    redis.call('set', KEYS[1], ARGV[2], 'px', ARGV[3])
+    redis.call('set', KEYS[2], cur + 1, 'px', ARGV[3])
+else
+    redis.call('set', KEYS[1], ARGV[2])
+    redis.call('set', KEYS[2], cur + 1)
+end
+return cur + 1
@@ -0,0 +1,424 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCASConflict         = errors.New("cache: cas 冲突, 值已经被修改")
+	ErrInvalidMemcachedKey = errors.New("cache: 无效的 memcached key")
+	ErrMemcachedServer     = errors.New("cache: memcached 返回错误")
+)
+
+// memcached 过期时间超过 30 天会被当作 unix 时间戳
+const memcachedMaxRelativeExpiration = 30 * 24 * time.Hour
+
+// MemcachedCache 基于 memcached 文本协议的缓存
+// 多个节点之间使用一致性哈希(与 ShardedCache 相同)分片, 每个节点维护一个连接池
+// 值使用 codec 编码, 默认为 BytesCodec, Get 返回 []byte
+type MemcachedCache struct {
+	mutex sync.RWMutex
+	ring  *hashRing
+	pools map[string]*memcachedPool
+
+	codec       Codec
+	timeout     time.Duration
+	maxIdleConn int
+	// LoadAndDelete cas 冲突时的重试策略, RetryStrategy 是有状态的, 每次调用都需要一个新的
+	newCASRetry func() RetryStrategy
+}
+
+type MemcachedCacheOption func(m *MemcachedCache)
+
+func WithMemcachedCodec(codec Codec) MemcachedCacheOption {
+	return func(m *MemcachedCache) {
+		m.codec = codec
+	}
+}
+
+// WithMemcachedTimeout ctx 没有设置超时的时候, 单次请求的超时时间
+func WithMemcachedTimeout(timeout time.Duration) MemcachedCacheOption {
+	return func(m *MemcachedCache) {
+		m.timeout = timeout
+	}
+}
+
+// WithMaxIdleConn 每个节点最多保留的空闲连接数
+func WithMaxIdleConn(n int) MemcachedCacheOption {
+	return func(m *MemcachedCache) {
+		m.maxIdleConn = n
+	}
+}
+
+// WithCASRetry LoadAndDelete 遇到 cas 冲突时的重试策略, 重试耗尽之后返回 ErrCASConflict
+func WithCASRetry(fn func() RetryStrategy) MemcachedCacheOption {
+	return func(m *MemcachedCache) {
+		m.newCASRetry = fn
+	}
+}
+
+func NewMemcachedCache(addrs []string, opts ...MemcachedCacheOption) *MemcachedCache {
+	res := &MemcachedCache{
+		ring:        newHashRing(160, defaultShardHash),
+		pools:       make(map[string]*memcachedPool, len(addrs)),
+		codec:       BytesCodec{},
+		timeout:     time.Second,
+		maxIdleConn: 8,
+		newCASRetry: func() RetryStrategy {
+			return &FixedIntervalRetryStrategy{
+				Interval: 10 * time.Millisecond,
+				MaxCnt:   10,
+			}
+		},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	for _, addr := range addrs {
+		res.AddServer(addr)
+	}
+	return res
+}
+
+func (m *MemcachedCache) AddServer(addr string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.pools[addr]; ok {
+		return
+	}
+	m.pools[addr] = &memcachedPool{
+		addr:    addr,
+		idle:    make(chan *memcachedConn, m.maxIdleConn),
+		timeout: m.timeout,
+	}
+	m.ring.add(addr)
+}
+
+func (m *MemcachedCache) RemoveServer(addr string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pool, ok := m.pools[addr]
+	if !ok {
+		return
+	}
+	delete(m.pools, addr)
+	m.ring.remove(addr)
+	pool.close()
+}
+
+func (m *MemcachedCache) Get(ctx context.Context, key string) (any, error) {
+	val, _, err := m.get(ctx, "get", key)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (m *MemcachedCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	data, err := m.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return m.store(ctx, fmt.Sprintf("set %s 0 %d %d", key, memcachedExpiration(expireTime), len(data)), key, data)
+}
+
+func (m *MemcachedCache) Delete(ctx context.Context, key string) error {
+	if err := checkMemcachedKey(key); err != nil {
+		return err
+	}
+	return m.do(ctx, key, func(conn *memcachedConn) error {
+		line, err := conn.call("delete "+key+"\r\n", nil)
+		if err != nil {
+			return err
+		}
+		// 删除不存在的 key 不是错误
+		if line != "DELETED" && line != "NOT_FOUND" {
+			return memcachedErr(line)
+		}
+		return nil
+	})
+}
+
+// LoadAndDelete memcached 没有 GETDEL, 使用 gets + cas(过期时间为 -1, 立刻过期)实现
+// 在 gets 和 cas 之间值被修改时按照 WithCASRetry 重新读取, 保证返回的就是被删除的值
+func (m *MemcachedCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	var timer *time.Timer
+	retry := m.newCASRetry()
+	for {
+		val, cas, err := m.Gets(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		err = m.store(ctx, fmt.Sprintf("cas %s 0 -1 0 %d", key, cas), key, []byte{})
+		if err == nil {
+			return val, nil
+		}
+		if !errors.Is(err, ErrCASConflict) {
+			return nil, err
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			return nil, err
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Gets 返回值以及 cas 标识, 配合 CompareAndSwap 实现乐观锁
+func (m *MemcachedCache) Gets(ctx context.Context, key string) ([]byte, uint64, error) {
+	return m.get(ctx, "gets", key)
+}
+
+// CompareAndSwap 值在 Gets 之后被修改过时返回 ErrCASConflict, 已经被删除时返回 errs.ErrKeyNotFound
+func (m *MemcachedCache) CompareAndSwap(ctx context.Context, key string, value any, cas uint64, expireTime time.Duration) error {
+	data, err := m.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return m.store(ctx, fmt.Sprintf("cas %s 0 %d %d %d", key, memcachedExpiration(expireTime), len(data), cas), key, data)
+}
+
+func (m *MemcachedCache) get(ctx context.Context, cmd string, key string) ([]byte, uint64, error) {
+	if err := checkMemcachedKey(key); err != nil {
+		return nil, 0, err
+	}
+	var (
+		val   []byte
+		cas   uint64
+		found bool
+	)
+	err := m.do(ctx, key, func(conn *memcachedConn) error {
+		if _, err := conn.rw.WriteString(cmd + " " + key + "\r\n"); err != nil {
+			return err
+		}
+		if err := conn.rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := conn.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes> [<cas unique>]
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				return memcachedErr(line)
+			}
+			size, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("%w, 无法解析响应 %s", ErrMemcachedServer, line)
+			}
+			if len(fields) > 4 {
+				if cas, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+					return fmt.Errorf("%w, 无法解析响应 %s", ErrMemcachedServer, line)
+				}
+			}
+			// 数据后面还有 \r\n
+			buf := make([]byte, size+2)
+			if _, err = io.ReadFull(conn.rw, buf); err != nil {
+				return err
+			}
+			val, found = buf[:size], true
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	return val, cas, nil
+}
+
+// store 执行 set/cas 等存储命令
+func (m *MemcachedCache) store(ctx context.Context, cmd string, key string, data []byte) error {
+	if err := checkMemcachedKey(key); err != nil {
+		return err
+	}
+	return m.do(ctx, key, func(conn *memcachedConn) error {
+		line, err := conn.call(cmd+"\r\n", data)
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "STORED":
+			return nil
+		case "EXISTS":
+			return ErrCASConflict
+		case "NOT_FOUND":
+			return fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+		default:
+			return memcachedErr(line)
+		}
+	})
+}
+
+// do 从 key 对应节点的连接池中取出连接执行 fn
+// 出现网络错误, 超时或者服务端错误时连接会被关闭, 不再放回连接池
+func (m *MemcachedCache) do(ctx context.Context, key string, fn func(conn *memcachedConn) error) error {
+	m.mutex.RLock()
+	addr, ok := m.ring.get(key)
+	pool := m.pools[addr]
+	m.mutex.RUnlock()
+	if !ok {
+		return ErrNoShard
+	}
+	conn, err := pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(m.timeout)
+	}
+	if err = conn.nc.SetDeadline(deadline); err != nil {
+		_ = conn.nc.Close()
+		return err
+	}
+	err = fn(conn)
+	// 只有正常的响应才能保证连接上没有残留的数据
+	if err == nil || errors.Is(err, ErrCASConflict) || errors.Is(err, errs.ErrKeyNotFound) {
+		pool.put(conn)
+		return err
+	}
+	_ = conn.nc.Close()
+	return err
+}
+
+// Close 关闭所有空闲连接
+func (m *MemcachedCache) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, pool := range m.pools {
+		pool.close()
+	}
+	return nil
+}
+
+type memcachedConn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+// call 发送命令, data 不为 nil 时紧接着发送数据块, 返回一行响应
+func (c *memcachedConn) call(cmd string, data []byte) (string, error) {
+	if _, err := c.rw.WriteString(cmd); err != nil {
+		return "", err
+	}
+	if data != nil {
+		if _, err := c.rw.Write(data); err != nil {
+			return "", err
+		}
+		if _, err := c.rw.WriteString("\r\n"); err != nil {
+			return "", err
+		}
+	}
+	if err := c.rw.Flush(); err != nil {
+		return "", err
+	}
+	return c.readLine()
+}
+
+func (c *memcachedConn) readLine() (string, error) {
+	line, err := c.rw.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(line, []byte("\r\n"))), nil
+}
+
+type memcachedPool struct {
+	addr    string
+	idle    chan *memcachedConn
+	timeout time.Duration
+}
+
+func (p *memcachedPool) get(ctx context.Context) (*memcachedConn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: p.timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &memcachedConn{
+		nc: nc,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}, nil
+}
+
+// put 连接池满了就直接关闭
+func (p *memcachedPool) put(conn *memcachedConn) {
+	select {
+	case p.idle <- conn:
+	default:
+		_ = conn.nc.Close()
+	}
+}
+
+func (p *memcachedPool) close() {
+	for {
+		select {
+		case conn := <-p.idle:
+			_ = conn.nc.Close()
+		default:
+			return
+		}
+	}
+}
+
+// memcachedExpiration 转换为 memcached 的过期时间(秒)
+// 0 表示永不过期, 不足一秒的向上取整, 超过 30 天的转换为 unix 时间戳
+func memcachedExpiration(expireTime time.Duration) int64 {
+	if expireTime <= 0 {
+		return 0
+	}
+	if expireTime > memcachedMaxRelativeExpiration {
+		return time.Now().Add(expireTime).Unix()
+	}
+	return int64((expireTime + time.Second - 1) / time.Second)
+}
+
+// checkMemcachedKey key 最长 250 字节, 不能包含空白和控制字符
+func checkMemcachedKey(key string) error {
+	if len(key) == 0 || len(key) > 250 {
+		return fmt.Errorf("%w, key: %s", ErrInvalidMemcachedKey, key)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return fmt.Errorf("%w, key: %s", ErrInvalidMemcachedKey, key)
+		}
+	}
+	return nil
+}
+
+func memcachedErr(line string) error {
+	return fmt.Errorf("%w, 返回信息 %s", ErrMemcachedServer, line)
+}
@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemcachedCache(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+
+	// 空值以及包含 \r\n 的值
+	require.NoError(t, c.Set(ctx, "key2", []byte("a\r\nb"), 0))
+	val, err = c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a\r\nb"), val)
+	require.NoError(t, c.Set(ctx, "key3", "", 0))
+	val, err = c.Get(ctx, "key3")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{}, val)
+
+	require.NoError(t, c.Delete(ctx, "key2"))
+	require.NoError(t, c.Delete(ctx, "key2"))
+	_, err = c.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	val, err = c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+	_, err = c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	_, err = c.LoadAndDelete(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	err = c.Set(ctx, "invalid key", "value", time.Minute)
+	assert.True(t, errors.Is(err, ErrInvalidMemcachedKey))
+	err = c.Set(ctx, "key4", 12, time.Minute)
+	assert.True(t, errors.Is(err, ErrCodecUnsupportedType))
+}
+
+func TestMemcachedCache_CompareAndSwap(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	val, cas, err := c.Gets(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+
+	// 别人先修改了
+	require.NoError(t, c.Set(ctx, "key1", "value2", time.Minute))
+	err = c.CompareAndSwap(ctx, "key1", "value3", cas, time.Minute)
+	assert.Equal(t, ErrCASConflict, err)
+
+	_, cas, err = c.Gets(ctx, "key1")
+	require.NoError(t, err)
+	require.NoError(t, c.CompareAndSwap(ctx, "key1", "value3", cas, time.Minute))
+	res, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value3"), res)
+
+	require.NoError(t, c.Delete(ctx, "key1"))
+	err = c.CompareAndSwap(ctx, "key1", "value4", cas, time.Minute)
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
+
+func TestMemcachedCache_LoadAndDeleteConflict(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{server.addr()}, WithCASRetry(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2}
+	}))
+	defer c.Close()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "conflict", "value1", time.Minute))
+	// 重试耗尽之后不再继续读取
+	_, err := c.LoadAndDelete(ctx, "conflict")
+	assert.True(t, errors.Is(err, ErrCASConflict))
+	val, err := c.Get(ctx, "conflict")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), val)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	c = NewMemcachedCache([]string{server.addr()}, WithCASRetry(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Minute, MaxCnt: 2}
+	}))
+	defer c.Close()
+	_, err = c.LoadAndDelete(timeoutCtx, "conflict")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestMemcachedCache_Expire(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Second))
+	time.Sleep(1500 * time.Millisecond)
+	_, err := c.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
+
+func TestMemcachedCache_MultiServer(t *testing.T) {
+	servers := []*fakeMemcached{newFakeMemcached(t), newFakeMemcached(t)}
+	c := NewMemcachedCache([]string{servers[0].addr(), servers[1].addr()}, WithMaxIdleConn(2))
+	defer c.Close()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				key := fmt.Sprintf("key%d-%d", i, j)
+				assert.NoError(t, c.Set(ctx, key, key, time.Minute))
+				val, err := c.Get(ctx, key)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte(key), val)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// key 被分布到了两个节点
+	assert.Greater(t, servers[0].len(), 0)
+	assert.Greater(t, servers[1].len(), 0)
+	assert.Equal(t, 100, servers[0].len()+servers[1].len())
+
+	// 节点移除之后, 所有的 key 都路由到剩下的节点
+	servers[1].close()
+	c.RemoveServer(servers[1].addr())
+	before := servers[0].len()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key-after%d", i), "value", time.Minute))
+	}
+	assert.Equal(t, before+10, servers[0].len())
+}
+
+func TestMemcachedCache_ServerError(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{server.addr()})
+	defer c.Close()
+	err := c.Set(context.Background(), "fail", "value", time.Minute)
+	assert.True(t, errors.Is(err, ErrMemcachedServer))
+	// 连接被关闭之后依旧可以正常使用
+	require.NoError(t, c.Set(context.Background(), "key1", "value", time.Minute))
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	assert.Equal(t, int64(0), memcachedExpiration(0))
+	assert.Equal(t, int64(1), memcachedExpiration(500*time.Millisecond))
+	assert.Equal(t, int64(60), memcachedExpiration(time.Minute))
+	assert.Greater(t, memcachedExpiration(31*24*time.Hour), time.Now().Unix())
+}
+
+// fakeMemcached 进程内的 memcached, 只实现 get/gets/set/cas/delete
+// key 为 fail 的 set 返回 SERVER_ERROR, key 为 conflict 的 cas 总是返回 EXISTS
+type fakeMemcached struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     map[string]fakeMemcachedItem
+	cas      uint64
+}
+
+type fakeMemcachedItem struct {
+	val      []byte
+	cas      uint64
+	deadline time.Time
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	res := &fakeMemcached{
+		listener: l,
+		data:     map[string]fakeMemcachedItem{},
+	}
+	go func() {
+		for {
+			conn, er := l.Accept()
+			if er != nil {
+				return
+			}
+			go res.serve(conn)
+		}
+	}()
+	t.Cleanup(res.close)
+	return res
+}
+
+func (f *fakeMemcached) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeMemcached) close() {
+	_ = f.listener.Close()
+}
+
+func (f *fakeMemcached) len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.data)
+}
+
+func (f *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+		var resp string
+		switch fields[0] {
+		case "get", "gets":
+			resp = f.get(fields[0] == "gets", fields[1])
+		case "set", "cas":
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(rw, data); err != nil {
+				return
+			}
+			exp, _ := strconv.ParseInt(fields[3], 10, 64)
+			var cas uint64
+			if fields[0] == "cas" {
+				cas, _ = strconv.ParseUint(fields[5], 10, 64)
+			}
+			resp = f.store(fields[0] == "cas", fields[1], data[:size], exp, cas)
+		case "delete":
+			resp = f.delete(fields[1])
+		default:
+			resp = "ERROR\r\n"
+		}
+		_, _ = rw.WriteString(resp)
+		_ = rw.Flush()
+	}
+}
+
+func (f *fakeMemcached) get(withCas bool, key string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	item, ok := f.data[key]
+	if !ok || (!item.deadline.IsZero() && item.deadline.Before(time.Now())) {
+		return "END\r\n"
+	}
+	if withCas {
+		return fmt.Sprintf("VALUE %s 0 %d %d\r\n%s\r\nEND\r\n", key, len(item.val), item.cas, item.val)
+	}
+	return fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND\r\n", key, len(item.val), item.val)
+}
+
+func (f *fakeMemcached) store(isCas bool, key string, val []byte, exp int64, cas uint64) string {
+	if key == "fail" {
+		return "SERVER_ERROR out of memory\r\n"
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if isCas && key == "conflict" {
+		return "EXISTS\r\n"
+	}
+	if isCas {
+		item, ok := f.data[key]
+		if !ok || (!item.deadline.IsZero() && item.deadline.Before(time.Now())) {
+			return "NOT_FOUND\r\n"
+		}
+		if item.cas != cas {
+			return "EXISTS\r\n"
+		}
+	}
+	if exp < 0 {
+		delete(f.data, key)
+		return "STORED\r\n"
+	}
+	f.cas++
+	item := fakeMemcachedItem{val: val, cas: f.cas}
+	if exp > 0 {
+		item.deadline = time.Now().Add(time.Duration(exp) * time.Second)
+	}
+	f.data[key] = item
+	return "STORED\r\n"
+}
+
+func (f *fakeMemcached) delete(key string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.data[key]; !ok {
+		return "NOT_FOUND\r\n"
+	}
+	delete(f.data, key)
+	return "DELETED\r\n"
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+var (
+	ErrFailedToPublishInvalidation = errors.New("cache: 发布失效消息失败")
+)
+
+// RedisSubscriber 订阅失效消息, *redis.Client 和 *redis.ClusterClient 都满足
+type RedisSubscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// MultiLevelCache 二级缓存: 本地 BuildInMapCache(L1) + RedisCache(L2)
+// 读: 先读 L1, 未命中读 L2 并回填 L1
+// 写/删: 同时作用于 L2 和 L1, 并通过 redis pub/sub 通知其它实例删除各自的 L1
+type MultiLevelCache struct {
+	local  *BuildInMapCache
+	remote *RedisCache
+
+	// 实例 ID, 用于忽略自己发出的失效消息
+	id      string
+	channel string
+	// L1 的最长过期时间, 避免其它实例的失效消息丢失之后 L1 长期不一致
+	localExpiration time.Duration
+
+	pubSub *redis.PubSub
+}
+
+type invalidation struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
+}
+
+type MultiLevelCacheOption func(m *MultiLevelCache)
+
+func WithInvalidationChannel(channel string) MultiLevelCacheOption {
+	return func(m *MultiLevelCache) {
+		m.channel = channel
+	}
+}
+
+func WithLocalExpiration(expiration time.Duration) MultiLevelCacheOption {
+	return func(m *MultiLevelCache) {
+		m.localExpiration = expiration
+	}
+}
+
+// NewMultiLevelCache sub 为 nil 时只发布失效消息, 不监听其它实例的消息
+func NewMultiLevelCache(local *BuildInMapCache, remote *RedisCache, sub RedisSubscriber,
+	opts ...MultiLevelCacheOption) *MultiLevelCache {
+	res := &MultiLevelCache{
+		local:           local,
+		remote:          remote,
+		id:              uuid.New().String(),
+		channel:         "cache:invalidation",
+		localExpiration: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	if sub != nil {
+		res.pubSub = sub.Subscribe(context.Background(), res.channel)
+		go res.listen(res.pubSub.Channel())
+	}
+
+	return res
+}
+
+func (m *MultiLevelCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := m.local.Get(ctx, key)
+	if err == nil {
+		return val, nil
+	}
+	val, ttl, err := m.remote.getWithTTL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// 回填 L1, 失败不影响本次读. L1 不能比 L2 更晚过期, 否则 L2 过期之后 L1 依旧返回旧值
+	localExpiration := m.localExpiration
+	if ttl > 0 && ttl < localExpiration {
+		localExpiration = ttl
+	}
+	_ = m.local.Set(ctx, key, val, localExpiration)
+	return val, nil
+}
+
+// Set L1 中保存的值与从 L2 回填的值类型一致, 否则写入的实例和其它实例读到的类型不同:
+// 配置了 codec 时保存编码之后的 []byte, 否则 L2 返回 string, []byte 和 string 保存为 string,
+// 其它类型由 go-redis 格式化, 无法保证一致, 只删除 L1, 下一次 Get 从 L2 回填
+func (m *MultiLevelCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	value, err := m.remote.encode(value)
+	if err != nil {
+		return err
+	}
+	err = m.remote.set(ctx, key, value, expireTime)
+	if err != nil {
+		return err
+	}
+	localExpiration := m.localExpiration
+	if expireTime > 0 && expireTime < localExpiration {
+		localExpiration = expireTime
+	}
+	if local, ok := m.localValue(value); ok {
+		_ = m.local.Set(ctx, key, local, localExpiration)
+	} else {
+		_ = m.local.Delete(ctx, key)
+	}
+	return m.publish(ctx, key)
+}
+
+// localValue 写入 L2 的值对应的 Get 的返回值
+func (m *MultiLevelCache) localValue(value any) (any, bool) {
+	if m.remote.codec != nil {
+		return value, true
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		return nil, false
+	}
+}
+
+func (m *MultiLevelCache) Delete(ctx context.Context, key string) error {
+	err := m.remote.Delete(ctx, key)
+	_ = m.local.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	return m.publish(ctx, key)
+}
+
+func (m *MultiLevelCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	val, err := m.remote.LoadAndDelete(ctx, key)
+	_ = m.local.Delete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return val, m.publish(ctx, key)
+}
+
+func (m *MultiLevelCache) publish(ctx context.Context, key string) error {
+	msg, err := json.Marshal(invalidation{Source: m.id, Key: key})
+	if err != nil {
+		return err
+	}
+	err = m.remote.client.Publish(ctx, m.channel, string(msg)).Err()
+	if err != nil {
+		return fmt.Errorf("%w, 原因：%s", ErrFailedToPublishInvalidation, err.Error())
+	}
+	return nil
+}
+
+// listen 处理其它实例发出的失效消息, channel 被关闭时退出
+func (m *MultiLevelCache) listen(ch <-chan *redis.Message) {
+	for msg := range ch {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			log.Printf("cache: 无法解析失效消息 %s, 原因: %s", msg.Payload, err.Error())
+			continue
+		}
+		if inv.Source == m.id {
+			continue
+		}
+		_ = m.local.Delete(context.Background(), inv.Key)
+	}
+}
+
+// Close 取消订阅, 不会关闭 L1 和 L2
+func (m *MultiLevelCache) Close() error {
+	if m.pubSub == nil {
+		return nil
+	}
+	return m.pubSub.Close()
+}
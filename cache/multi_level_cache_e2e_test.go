@@ -0,0 +1,41 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMultiLevelCache_e2e_Invalidation(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	local1 := NewBuildInMapCache(time.Minute)
+	c1 := NewMultiLevelCache(local1, NewRedisCache(rdb), rdb)
+	defer c1.Close()
+	local2 := NewBuildInMapCache(time.Minute)
+	c2 := NewMultiLevelCache(local2, NewRedisCache(rdb), rdb)
+	defer c2.Close()
+	// 等待订阅建立
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, c1.Set(ctx, "multi-key1", "value1", time.Minute))
+	val, err := c2.Get(ctx, "multi-key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+
+	require.NoError(t, c1.Delete(ctx, "multi-key1"))
+	time.Sleep(100 * time.Millisecond)
+	_, err = local2.Get(ctx, "multi-key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geek_cache/cache/mocks"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMultiLevelCache_Get(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		local   func() *BuildInMapCache
+		key     string
+		wantVal any
+		wantErr error
+		// 读完之后 L1 中的值
+		wantLocal any
+	}{
+		{
+			name: "local hit",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mocks.NewMockCmdable(ctrl)
+			},
+			local: func() *BuildInMapCache {
+				res := NewBuildInMapCache(time.Minute)
+				require.NoError(t, res.Set(context.Background(), "key1", "local", time.Minute))
+				return res
+			},
+			key:       "key1",
+			wantVal:   "local",
+			wantLocal: "local",
+		},
+		{
+			name: "remote hit",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{"remote", int64(-1)})
+				cmd.EXPECT().Eval(context.Background(), getTTLLua, []string{"key1"}).
+					Return(res)
+				return cmd
+			},
+			local: func() *BuildInMapCache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			key:       "key1",
+			wantVal:   "remote",
+			wantLocal: "remote",
+		},
+		{
+			name: "remote error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(context.Background(), getTTLLua, []string{"key1"}).
+					Return(res)
+				return cmd
+			},
+			local: func() *BuildInMapCache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			key:     "key1",
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			local := tc.local()
+			c := NewMultiLevelCache(local, NewRedisCache(tc.mock(ctrl)), nil)
+			val, err := c.Get(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, val)
+			localVal, err := local.Get(context.Background(), tc.key)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantLocal, localVal)
+		})
+	}
+}
+
+func TestMultiLevelCache_GetRemoteTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal([]any{"remote", int64(20)})
+	cmd.EXPECT().Eval(context.Background(), getTTLLua, []string{"key1"}).Return(res)
+
+	local := NewBuildInMapCache(time.Minute)
+	c := NewMultiLevelCache(local, NewRedisCache(cmd), nil)
+	val, err := c.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "remote", val)
+	// L2 只剩 20ms, L1 同样在 20ms 之后过期
+	time.Sleep(50 * time.Millisecond)
+	_, err = local.Get(context.Background(), "key1")
+	assert.ErrorIs(t, err, errs.ErrKeyNotFound)
+}
+
+func TestMultiLevelCache_Set(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		wantErr error
+		// Set 之后 L1 中是否有值
+		wantLocal bool
+	}{
+		{
+			name: "set",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Set(context.Background(), "key1", "value1", time.Second).
+					Return(redis.NewStatusResult("OK", nil))
+				cmd.EXPECT().Publish(context.Background(), "cache:invalidation", gomock.Any()).
+					Return(redis.NewIntResult(1, nil))
+				return cmd
+			},
+			wantLocal: true,
+		},
+		{
+			name: "remote error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Set(context.Background(), "key1", "value1", time.Second).
+					Return(redis.NewStatusResult("", context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "publish error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Set(context.Background(), "key1", "value1", time.Second).
+					Return(redis.NewStatusResult("OK", nil))
+				cmd.EXPECT().Publish(context.Background(), "cache:invalidation", gomock.Any()).
+					Return(redis.NewIntResult(0, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr:   ErrFailedToPublishInvalidation,
+			wantLocal: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			local := NewBuildInMapCache(time.Minute)
+			c := NewMultiLevelCache(local, NewRedisCache(tc.mock(ctrl)), nil)
+			err := c.Set(context.Background(), "key1", "value1", time.Second)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			_, err = local.Get(context.Background(), "key1")
+			assert.Equal(t, tc.wantLocal, err == nil)
+		})
+	}
+}
+
+func TestMultiLevelCache_SetLocalType(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Set(ctx, "key1", 12, time.Minute).Return(redis.NewStatusResult("OK", nil))
+	cmd.EXPECT().Set(ctx, "key2", []byte("value2"), time.Minute).Return(redis.NewStatusResult("OK", nil))
+	cmd.EXPECT().Publish(ctx, "cache:invalidation", gomock.Any()).Return(redis.NewIntResult(1, nil)).Times(2)
+	res := redis.NewCmd(ctx)
+	res.SetVal([]any{"12", int64(-1)})
+	cmd.EXPECT().Eval(ctx, getTTLLua, []string{"key1"}).Return(res)
+
+	local := NewBuildInMapCache(time.Minute)
+	c := NewMultiLevelCache(local, NewRedisCache(cmd), nil)
+	// 与其它实例从 L2 读到的一样是 string
+	require.NoError(t, c.Set(ctx, "key1", 12, time.Minute))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "12", val)
+	require.NoError(t, c.Set(ctx, "key2", []byte("value2"), time.Minute))
+	val, err = c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+}
+
+func TestMultiLevelCache_Codec(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	data, err := JSONCodec{}.Encode(codecUser{Name: "Tom", Age: 18})
+	require.NoError(t, err)
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Set(ctx, "key1", data, time.Minute).Return(redis.NewStatusResult("OK", nil))
+	cmd.EXPECT().Publish(ctx, "cache:invalidation", gomock.Any()).Return(redis.NewIntResult(1, nil))
+	res := redis.NewCmd(ctx)
+	res.SetVal([]any{string(data), int64(-1)})
+	cmd.EXPECT().Eval(ctx, getTTLLua, []string{"key1"}).Return(res)
+
+	// 写入的实例和从 L2 回填的实例, L1 中都是编码之后的 []byte
+	writer := NewMultiLevelCache(NewBuildInMapCache(time.Minute), NewRedisCache(cmd, WithCodec(JSONCodec{})), nil)
+	require.NoError(t, writer.Set(ctx, "key1", codecUser{Name: "Tom", Age: 18}, time.Minute))
+	written, err := writer.Get(ctx, "key1")
+	require.NoError(t, err)
+	reader := NewMultiLevelCache(NewBuildInMapCache(time.Minute), NewRedisCache(cmd, WithCodec(JSONCodec{})), nil)
+	loaded, err := reader.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, data, written)
+	assert.Equal(t, written, loaded)
+}
+
+func TestMultiLevelCache_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Del(context.Background(), "key1", "{key1}:lease").Return(redis.NewIntResult(1, nil))
+	cmd.EXPECT().Publish(context.Background(), "cache:invalidation", gomock.Any()).
+		Return(redis.NewIntResult(1, nil))
+
+	local := NewBuildInMapCache(time.Minute)
+	require.NoError(t, local.Set(context.Background(), "key1", "value1", time.Minute))
+	c := NewMultiLevelCache(local, NewRedisCache(cmd), nil)
+	require.NoError(t, c.Delete(context.Background(), "key1"))
+	_, err := local.Get(context.Background(), "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
+
+func TestMultiLevelCache_listen(t *testing.T) {
+	local := NewBuildInMapCache(time.Minute)
+	c := NewMultiLevelCache(local, NewRedisCache(nil), nil)
+	ctx := context.Background()
+	require.NoError(t, local.Set(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, local.Set(ctx, "key2", "value2", time.Minute))
+
+	ch := make(chan *redis.Message, 3)
+	// 自己发出的消息被忽略
+	self, err := json.Marshal(invalidation{Source: c.id, Key: "key1"})
+	require.NoError(t, err)
+	ch <- &redis.Message{Payload: string(self)}
+	ch <- &redis.Message{Payload: "invalid"}
+	other, err := json.Marshal(invalidation{Source: "other", Key: "key2"})
+	require.NoError(t, err)
+	ch <- &redis.Message{Payload: string(other)}
+	close(ch)
+	c.listen(ch)
+
+	_, err = local.Get(ctx, "key1")
+	assert.NoError(t, err)
+	_, err = local.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLimiterParams = errors.New("cache: 限流器参数错误")
+
+// Limiter 限流器, 一个限流器对应一个限流对象(例如一个接口或者一个用户)
+type Limiter interface {
+	// Allow 不阻塞, 返回当前请求是否被允许
+	Allow(ctx context.Context) (bool, error)
+	// Wait 阻塞直到请求被允许, 或者 ctx 过期
+	Wait(ctx context.Context) error
+}
+
+// reserveFunc 尝试获取一次许可, 返回 0 表示已经获得许可, 否则为预计需要等待的时间
+type reserveFunc func(ctx context.Context) (time.Duration, error)
+
+func allow(ctx context.Context, reserve reserveFunc) (bool, error) {
+	d, err := reserve(ctx)
+	if err != nil {
+		return false, err
+	}
+	return d <= 0, nil
+}
+
+// wait 按照预计的等待时间重试, 等待结束之后许可可能已经被其它请求拿走, 所以需要循环
+func wait(ctx context.Context, reserve reserveFunc) error {
+	var timer *time.Timer
+	for {
+		d, err := reserve(ctx)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return nil
+		}
+		if timer == nil {
+			timer = time.NewTimer(d)
+			defer timer.Stop()
+		} else {
+			timer.Reset(d)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// validateTokenBucketParams rate 为 0 时计算等待时间会除以 0, burst 小于 1 时永远拿不到令牌
+func validateTokenBucketParams(rate float64, burst int) error {
+	// NaN 也不满足 rate > 0
+	if !(rate > 0) {
+		return fmt.Errorf("%w, rate 必须大于 0, rate: %v", ErrInvalidLimiterParams, rate)
+	}
+	if burst < 1 {
+		return fmt.Errorf("%w, burst 不能小于 1, burst: %d", ErrInvalidLimiterParams, burst)
+	}
+	return nil
+}
+
+// validateWindowParams limit 小于 1 时永远不会放行
+func validateWindowParams(window time.Duration, limit int) error {
+	if window <= 0 {
+		return fmt.Errorf("%w, window 必须大于 0, window: %s", ErrInvalidLimiterParams, window)
+	}
+	if limit < 1 {
+		return fmt.Errorf("%w, limit 不能小于 1, limit: %d", ErrInvalidLimiterParams, limit)
+	}
+	return nil
+}
+
+// TokenBucketLimiter 本地令牌桶, 每秒生成 rate 个令牌, 最多积攒 burst 个
+type TokenBucketLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func NewTokenBucketLimiter(rate float64, burst int) (*TokenBucketLimiter, error) {
+	if err := validateTokenBucketParams(rate, burst); err != nil {
+		return nil, err
+	}
+	res := &TokenBucketLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+	res.last = res.now()
+	return res, nil
+}
+
+func (t *TokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, t.reserve)
+}
+
+func (t *TokenBucketLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, t.reserve)
+}
+
+func (t *TokenBucketLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	if now.After(t.last) {
+		t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+		t.last = now
+	}
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0, nil
+	}
+	return time.Duration(math.Ceil((1 - t.tokens) / t.rate * float64(time.Second))), nil
+}
+
+// FixedWindowLimiter 本地固定窗口, 每个窗口内最多允许 limit 个请求
+// 窗口从第一个请求开始计算, 与 redis 版本的行为一致
+type FixedWindowLimiter struct {
+	mutex  sync.Mutex
+	window time.Duration
+	limit  int
+	cnt    int
+	start  time.Time
+	now    func() time.Time
+}
+
+func NewFixedWindowLimiter(window time.Duration, limit int) (*FixedWindowLimiter, error) {
+	if err := validateWindowParams(window, limit); err != nil {
+		return nil, err
+	}
+	return &FixedWindowLimiter{
+		window: window,
+		limit:  limit,
+		now:    time.Now,
+	}, nil
+}
+
+func (f *FixedWindowLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, f.reserve)
+}
+
+func (f *FixedWindowLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, f.reserve)
+}
+
+func (f *FixedWindowLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := f.now()
+	end := f.start.Add(f.window)
+	if !now.Before(end) {
+		f.start = now
+		f.cnt = 0
+		end = now.Add(f.window)
+	}
+	if f.cnt < f.limit {
+		f.cnt++
+		return 0, nil
+	}
+	return end.Sub(now), nil
+}
+
+// SlidingWindowLimiter 本地滑动窗口日志, 任意 window 时间内最多允许 limit 个请求
+// 保存窗口内每个请求的时间, 内存占用与 limit 成正比
+type SlidingWindowLimiter struct {
+	mutex  sync.Mutex
+	window time.Duration
+	limit  int
+	// 窗口内的请求时间, 按照时间升序
+	log []time.Time
+	now func() time.Time
+}
+
+func NewSlidingWindowLimiter(window time.Duration, limit int) (*SlidingWindowLimiter, error) {
+	if err := validateWindowParams(window, limit); err != nil {
+		return nil, err
+	}
+	return &SlidingWindowLimiter{
+		window: window,
+		limit:  limit,
+		now:    time.Now,
+	}, nil
+}
+
+func (s *SlidingWindowLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, s.reserve)
+}
+
+func (s *SlidingWindowLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, s.reserve)
+}
+
+func (s *SlidingWindowLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	boundary := now.Add(-s.window)
+	i := 0
+	for i < len(s.log) && !s.log[i].After(boundary) {
+		i++
+	}
+	s.log = s.log[i:]
+	if len(s.log) < s.limit {
+		s.log = append(s.log, now)
+		return 0, nil
+	}
+	return s.log[0].Add(s.window).Sub(now), nil
+}
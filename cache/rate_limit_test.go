@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	l, err := NewTokenBucketLimiter(10, 2)
+	require.NoError(t, err)
+	l.now = clock.Now
+	l.last = clock.now
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		ok, err := l.Allow(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, _ := l.Allow(ctx)
+	assert.False(t, ok)
+	d, _ := l.reserve(ctx)
+	assert.Equal(t, 100*time.Millisecond, d)
+
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	ok, _ = l.Allow(ctx)
+	assert.True(t, ok)
+
+	// 最多积攒 burst 个令牌
+	clock.now = clock.now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		ok, _ = l.Allow(ctx)
+		assert.True(t, ok)
+	}
+	ok, _ = l.Allow(ctx)
+	assert.False(t, ok)
+}
+
+func TestFixedWindowLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	l, err := NewFixedWindowLimiter(time.Second, 2)
+	require.NoError(t, err)
+	l.now = clock.Now
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow(ctx)
+		assert.True(t, ok)
+	}
+	clock.now = clock.now.Add(300 * time.Millisecond)
+	d, _ := l.reserve(ctx)
+	assert.Equal(t, 700*time.Millisecond, d)
+
+	clock.now = clock.now.Add(700 * time.Millisecond)
+	ok, _ := l.Allow(ctx)
+	assert.True(t, ok)
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	l, err := NewSlidingWindowLimiter(time.Second, 2)
+	require.NoError(t, err)
+	l.now = clock.Now
+	ctx := context.Background()
+
+	ok, _ := l.Allow(ctx)
+	assert.True(t, ok)
+	clock.now = clock.now.Add(600 * time.Millisecond)
+	ok, _ = l.Allow(ctx)
+	assert.True(t, ok)
+	clock.now = clock.now.Add(200 * time.Millisecond)
+	d, _ := l.reserve(ctx)
+	assert.Equal(t, 200*time.Millisecond, d)
+
+	// 第一个请求滑出窗口, 第二个请求还在
+	clock.now = clock.now.Add(200 * time.Millisecond)
+	ok, _ = l.Allow(ctx)
+	assert.True(t, ok)
+	ok, _ = l.Allow(ctx)
+	assert.False(t, ok)
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	l, err := NewTokenBucketLimiter(20, 1)
+	require.NoError(t, err)
+	ok, _ := l.Allow(context.Background())
+	require.True(t, ok)
+
+	start := time.Now()
+	require.NoError(t, l.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+}
+
+func TestNewLimiter_Invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		new  func() error
+	}{
+		{
+			name: "zero rate",
+			new: func() error {
+				_, err := NewTokenBucketLimiter(0, 1)
+				return err
+			},
+		},
+		{
+			name: "negative rate",
+			new: func() error {
+				_, err := NewTokenBucketLimiter(-1, 1)
+				return err
+			},
+		},
+		{
+			name: "zero burst",
+			new: func() error {
+				_, err := NewTokenBucketLimiter(10, 0)
+				return err
+			},
+		},
+		{
+			name: "fixed window zero limit",
+			new: func() error {
+				_, err := NewFixedWindowLimiter(time.Second, 0)
+				return err
+			},
+		},
+		{
+			name: "fixed window zero window",
+			new: func() error {
+				_, err := NewFixedWindowLimiter(0, 1)
+				return err
+			},
+		},
+		{
+			name: "sliding window zero limit",
+			new: func() error {
+				_, err := NewSlidingWindowLimiter(time.Second, 0)
+				return err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, errors.Is(tc.new(), ErrInvalidLimiterParams))
+		})
+	}
+}
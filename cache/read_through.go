@@ -18,12 +18,19 @@ type ReadThrough struct {
 	Cache
 	LoadFunc   func(ctx context.Context, key string) (any, error)
 	ExpireTime time.Duration
+	// XFetchBeta 大于 0 时开启 XFetch 提前刷新(见 xfetch.go), 一般设置为 1, 越大越早刷新
+	// 开启之后 LoadFunc 返回的值必须是 []byte 或者 string, 否则不会写入缓存, 并返回 ErrFailedToRefreshCache
+	// Cache 必须原样存取 []byte, 例如 RedisCache 不能配置 JSONCodec
+	XFetchBeta float64
 }
 
 // Get 读穿透
 func (r *ReadThrough) Get(ctx context.Context, key string) (any, error) {
+	if r.XFetchBeta > 0 {
+		return r.getXFetch(ctx, key)
+	}
 	val, err := r.Cache.Get(ctx, key)
-	if err == errs.ErrKeyNotFound {
+	if errors.Is(err, errs.ErrKeyNotFound) {
 		val, err = r.LoadFunc(ctx, key)
 		if err == nil {
 			er := r.Cache.Set(ctx, key, val, r.ExpireTime)
@@ -38,7 +45,7 @@ func (r *ReadThrough) Get(ctx context.Context, key string) (any, error) {
 // GetAsync 读穿透(异步)
 func (r *ReadThrough) GetAsync(ctx context.Context, key string) (any, error) {
 	val, err := r.Cache.Get(ctx, key)
-	if err == errs.ErrKeyNotFound {
+	if errors.Is(err, errs.ErrKeyNotFound) {
 		go func() {
 			val, err = r.LoadFunc(ctx, key)
 			if err == nil {
@@ -55,7 +62,7 @@ func (r *ReadThrough) GetAsync(ctx context.Context, key string) (any, error) {
 // GetSemiAsync 读穿透(半异步)
 func (r *ReadThrough) GetSemiAsync(ctx context.Context, key string) (any, error) {
 	val, err := r.Cache.Get(ctx, key)
-	if err == errs.ErrKeyNotFound {
+	if errors.Is(err, errs.ErrKeyNotFound) {
 		val, err = r.LoadFunc(ctx, key)
 		go func() {
 			if err == nil {
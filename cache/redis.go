@@ -3,27 +3,105 @@ package cache
 
 import (
 	"context"
+	_ "embed"
 	"fmt"
 	"geek_cache/internal/errs"
 	"github.com/go-redis/redis/v9"
+	"golang.org/x/sync/errgroup"
+	"sync"
 	"time"
 )
 
+var (
+	//go:embed lua/get_ttl.lua
+	getTTLLua string
+	//go:embed lua/get_del.lua
+	getDelLua string
+)
+
 type RedisCache struct {
 	client redis.Cmdable
+	// codec 为 nil 时值直接交给 go-redis 处理, Get 返回 string
+	// 否则 Set 前先编码, Get 返回编码后的 []byte, 可以使用 GetAs 解码
+	codec Codec
+	// cluster 为 true 时多 key 命令按照 slot 拆分
+	cluster bool
+	// versioning 为 true 时每次写入同时维护版本号, 见 WithVersioning
+	versioning bool
+}
+
+type RedisCacheOption func(r *RedisCache)
+
+func WithCodec(codec Codec) RedisCacheOption {
+	return func(r *RedisCache) {
+		r.codec = codec
+	}
+}
+
+// WithClusterMode 多 key 命令按照 slot 拆分执行
+// client 是 *redis.ClusterClient 时会自动开启, 被其它类型包装过的集群客户端需要手动开启
+func WithClusterMode() RedisCacheOption {
+	return func(r *RedisCache) {
+		r.cluster = true
+	}
 }
 
-func NewRedisCache(client redis.Cmdable) *RedisCache {
-	return &RedisCache{
-		client: client,
+// WithVersioning 开启版本号, 之后才能使用 GetWithVersion 和 SetIfVersion
+// 版本号保存在另一个 key 中, 所有的写入都变成 lua 脚本, key 的数量翻倍, 不需要乐观锁时不要开启
+// 同一个 redis 中的 key 要么都通过开启了版本号的 RedisCache 写入, 要么都不开启, 否则版本号无法发现并发的写入
+func WithVersioning() RedisCacheOption {
+	return func(r *RedisCache) {
+		r.versioning = true
 	}
 }
 
+func NewRedisCache(client redis.Cmdable, opts ...RedisCacheOption) *RedisCache {
+	res := &RedisCache{
+		client:  client,
+		cluster: isClusterClient(client),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
 func (r *RedisCache) Get(ctx context.Context, key string) (any, error) {
-	return r.client.Get(ctx, key).Result()
+	if r.codec != nil {
+		data, err := r.client.Get(ctx, key).Bytes()
+		if err != nil {
+			return nil, keyNotFound(key, err)
+		}
+		return data, nil
+	}
+	val, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		return nil, keyNotFound(key, err)
+	}
+	return val, nil
 }
 
 func (r *RedisCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	value, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.set(ctx, key, value, expireTime)
+}
+
+// encode 配置了 codec 时编码, 结果与 Get 返回的类型一致
+func (r *RedisCache) encode(value any) (any, error) {
+	if r.codec == nil {
+		return value, nil
+	}
+	return r.codec.Encode(value)
+}
+
+// set 写入已经编码过的值, 开启版本号时同时增加版本号, 见 SetIfVersion
+func (r *RedisCache) set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	if r.versioning {
+		return r.setWithVersion(ctx, key, value, expireTime)
+	}
 	result, err := r.client.Set(ctx, key, value, expireTime).Result()
 	if err != nil {
 		return err
@@ -34,11 +112,166 @@ func (r *RedisCache) Set(ctx context.Context, key string, value any, expireTime
 	return nil
 }
 
+// Delete 同时删除租约(以及版本号), 使未完成的 SetWithLease 失效
 func (r *RedisCache) Delete(ctx context.Context, key string) error {
-	_, err := r.client.Del(ctx, key).Result()
+	_, err := r.client.Del(ctx, r.withCompanionKeys(key)...).Result()
 	return err
 }
 
+// LoadAndDelete 与 Delete 一样同时删除租约(以及版本号)
 func (r *RedisCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
-	return r.client.GetDel(ctx, key).Result()
+	val, err := r.client.Eval(ctx, getDelLua, r.withCompanionKeys(key)).Text()
+	if err != nil {
+		return nil, keyNotFound(key, err)
+	}
+	if r.codec != nil {
+		return []byte(val), nil
+	}
+	return val, nil
+}
+
+// withCompanionKeys key 以及删除 key 时需要一起删除的租约, 开启版本号时还有版本号
+func (r *RedisCache) withCompanionKeys(key string) []string {
+	if r.versioning {
+		return []string{key, leaseKey(key), versionKey(key)}
+	}
+	return []string{key, leaseKey(key)}
+}
+
+// getWithTTL 同时返回剩余的过期时间, 永不过期时返回 0
+func (r *RedisCache) getWithTTL(ctx context.Context, key string) (any, time.Duration, error) {
+	res, err := r.client.Eval(ctx, getTTLLua, []string{key}).Slice()
+	if err != nil {
+		return nil, 0, keyNotFound(key, err)
+	}
+	if len(res) != 2 {
+		return nil, 0, fmt.Errorf("cache: 脚本返回值格式错误 %v", res)
+	}
+	str, _ := res[0].(string)
+	var ttl time.Duration
+	if ms, _ := res[1].(int64); ms > 0 {
+		ttl = time.Duration(ms) * time.Millisecond
+	}
+	if r.codec != nil {
+		return []byte(str), ttl, nil
+	}
+	return str, ttl, nil
+}
+
+// GetAs 读取并解码为 T
+// 没有配置 codec 时使用 go-redis 的 Scan, 支持基本类型和 encoding.BinaryUnmarshaler
+func GetAs[T any](ctx context.Context, r *RedisCache, key string) (T, error) {
+	var res T
+	if r.codec == nil {
+		err := r.client.Get(ctx, key).Scan(&res)
+		return res, keyNotFound(key, err)
+	}
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return res, keyNotFound(key, err)
+	}
+	err = r.codec.Decode(data, &res)
+	return res, err
+}
+
+// keyNotFound 把 redis.Nil 转换为 errs.ErrKeyNotFound, 与 BuildInMapCache 保持一致
+func keyNotFound(key string, err error) error {
+	if err == redis.Nil {
+		return fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	return err
+}
+
+func (r *RedisCache) GetMulti(ctx context.Context, keys []string) (map[string]any, error) {
+	res := make(map[string]any, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+	if !r.cluster {
+		return res, r.mget(ctx, keys, res)
+	}
+	// 集群模式下 MGET 的 key 必须在同一个 slot
+	var mutex sync.Mutex
+	var eg errgroup.Group
+	for _, ks := range GroupBySlot(keys) {
+		ks := ks
+		eg.Go(func() error {
+			sub := make(map[string]any, len(ks))
+			if err := r.mget(ctx, ks, sub); err != nil {
+				return err
+			}
+			mutex.Lock()
+			for k, v := range sub {
+				res[k] = v
+			}
+			mutex.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *RedisCache) mget(ctx context.Context, keys []string, res map[string]any) error {
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	for i, val := range vals {
+		// 不存在的 key 返回 nil
+		str, ok := val.(string)
+		if !ok {
+			continue
+		}
+		if r.codec != nil {
+			res[keys[i]] = []byte(str)
+		} else {
+			res[keys[i]] = str
+		}
+	}
+	return nil
+}
+
+// SetMulti MSET 不支持过期时间, 所以使用 pipeline 执行多个 SET, 开启版本号时执行多个与 Set 相同的脚本
+// 集群模式下 ClusterClient 的 pipeline 会按照节点拆分, 不需要额外处理
+func (r *RedisCache) SetMulti(ctx context.Context, kvs map[string]any, expireTime time.Duration) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range kvs {
+			value, err := r.encode(value)
+			if err != nil {
+				return err
+			}
+			if r.versioning {
+				pipe.Eval(ctx, versionSetLua, []string{key, versionKey(key)}, -1, value, expireTime.Milliseconds())
+			} else {
+				pipe.Set(ctx, key, value, expireTime)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisCache) DeleteMulti(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// 租约和版本号与 key 在同一个 slot, 不影响集群模式下的分组
+	all := make([]string, 0, 3*len(keys))
+	for _, key := range keys {
+		all = append(all, r.withCompanionKeys(key)...)
+	}
+	if !r.cluster {
+		return r.client.Del(ctx, all...).Err()
+	}
+	var eg errgroup.Group
+	for _, ks := range GroupBySlot(all) {
+		ks := ks
+		eg.Go(func() error {
+			return r.client.Del(ctx, ks...).Err()
+		})
+	}
+	return eg.Wait()
 }
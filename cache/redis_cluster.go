@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v9"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Redis Cluster 使用 CRC16(key) % 16384 计算 slot
+// 多 key 命令(MGET, DEL 多个 key)以及 lua 脚本中的所有 KEYS 必须落在同一个 slot, 否则会返回 CROSSSLOT
+// key 中包含 {tag} 时只使用 tag 计算 slot, 因此需要放在一起的 key 可以使用同一个 hash tag
+const clusterSlots = 16384
+
+// HashTag 生成带 hash tag 的 key, 相同 tag 的 key 一定落在同一个 slot
+// 例如 HashTag("user:1", "profile") => "{user:1}profile"
+func HashTag(tag string, key string) string {
+	return "{" + tag + "}" + key
+}
+
+// KeySlot 计算 key 在 Redis Cluster 中的 slot
+func KeySlot(key string) int {
+	if tag, ok := hashTagOf(key); ok {
+		key = tag
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// hashTagOf 返回 key 中参与计算 slot 的 tag: 第一个 { 与它之后第一个 } 之间的部分
+// {} 为空时依旧使用整个 key, 第二个返回值为 false
+func hashTagOf(key string) (string, bool) {
+	if s := strings.IndexByte(key, '{'); s > -1 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+e+1], true
+		}
+	}
+	return "", false
+}
+
+var (
+	slotTagsOnce sync.Once
+	slotTags     []string
+)
+
+// slotTag 返回一个落在 slot 上的 tag, tag 只包含数字
+// 从 0 开始依次尝试, 直到覆盖所有的 slot, 第一次调用时计算, 大约需要十万次 crc16
+func slotTag(slot int) string {
+	slotTagsOnce.Do(func() {
+		slotTags = make([]string, clusterSlots)
+		for i, left := 0, clusterSlots; left > 0; i++ {
+			tag := strconv.Itoa(i)
+			if s := crc16(tag) % clusterSlots; slotTags[s] == "" {
+				slotTags[s] = tag
+				left--
+			}
+		}
+	})
+	return slotTags[slot]
+}
+
+// GroupBySlot 按照 slot 对 key 分组, 组内保持原有顺序
+func GroupBySlot(keys []string) map[int][]string {
+	res := make(map[int][]string)
+	for _, key := range keys {
+		slot := KeySlot(key)
+		res[slot] = append(res[slot], key)
+	}
+	return res
+}
+
+// crc16 CRC16-CCITT(XMODEM), 与 Redis Cluster 规范一致
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func isClusterClient(client redis.Cmdable) bool {
+	_, ok := client.(*redis.ClusterClient)
+	return ok
+}
+
+// isRetryableErr 主从切换或者集群迁移期间的临时错误
+// go-redis 本身会按照 MaxRetries 重试这些错误, 这里用于重试次数耗尽之后由上层决定是否继续
+// MOVED/ASK 由 ClusterClient 自动重定向, 只有在非集群客户端连到集群时才会出现
+func isRetryableErr(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, prefix := range []string{"READONLY ", "LOADING ", "MASTERDOWN ", "TRYAGAIN ", "CLUSTERDOWN ", "MOVED ", "ASK "} {
+		if redis.HasErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
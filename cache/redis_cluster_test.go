@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"geek_cache/cache/mocks"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      string
+		wantSlot int
+	}{
+		{
+			name:     "plain key",
+			key:      "foo",
+			wantSlot: 12182,
+		},
+		{
+			// CRC16 校验值 0x31C3
+			name:     "check value",
+			key:      "123456789",
+			wantSlot: 0x31C3,
+		},
+		{
+			name:     "hash tag",
+			key:      "{foo}bar",
+			wantSlot: 12182,
+		},
+		{
+			name:     "empty hash tag",
+			key:      "{}foo",
+			wantSlot: KeySlot("{}foo"),
+		},
+		{
+			name:     "hash tag helper",
+			key:      HashTag("foo", "bar"),
+			wantSlot: 12182,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantSlot, KeySlot(tc.key))
+		})
+	}
+	assert.NotEqual(t, KeySlot("foo"), KeySlot("{}foo"))
+}
+
+func TestGroupBySlot(t *testing.T) {
+	res := GroupBySlot([]string{"{user1}name", "other", "{user1}age"})
+	assert.Equal(t, map[int][]string{
+		KeySlot("user1"): {"{user1}name", "{user1}age"},
+		KeySlot("other"): {"other"},
+	}, res)
+}
+
+func TestRedisCache_ClusterMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().MGet(context.Background(), "{user1}name", "{user1}age").
+		Return(redis.NewSliceResult([]any{"Tom", "18"}, nil))
+	cmd.EXPECT().MGet(context.Background(), "other").
+		Return(redis.NewSliceResult([]any{nil}, nil))
+	cmd.EXPECT().Del(context.Background(), "{user1}name", "{user1}name:lease", "{user1}age", "{user1}age:lease").
+		Return(redis.NewIntResult(2, nil))
+	cmd.EXPECT().Del(context.Background(), "other", "{other}:lease").
+		Return(redis.NewIntResult(0, nil))
+
+	c := NewRedisCache(cmd, WithClusterMode())
+	keys := []string{"{user1}name", "other", "{user1}age"}
+	res, err := c.GetMulti(context.Background(), keys)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"{user1}name": "Tom", "{user1}age": "18"}, res)
+	require.NoError(t, c.DeleteMulti(context.Background(), keys))
+}
+
+func TestIsRetryableErr(t *testing.T) {
+	assert.True(t, isRetryableErr(redisErr("READONLY You can't write against a read only replica.")))
+	assert.True(t, isRetryableErr(redisErr("CLUSTERDOWN The cluster is down")))
+	assert.True(t, isRetryableErr(context.DeadlineExceeded))
+	assert.False(t, isRetryableErr(context.Canceled))
+	assert.False(t, isRetryableErr(redisErr("ERR unknown command")))
+	assert.False(t, isRetryableErr(nil))
+}
+
+func TestSlotTag(t *testing.T) {
+	for slot := 0; slot < clusterSlots; slot++ {
+		assert.Equal(t, slot, KeySlot(HashTag(slotTag(slot), "key")))
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	//go:embed lua/fair_lock.lua
+	fairLockLua string
+	//go:embed lua/fair_lock_leave.lua
+	fairLockLeaveLua string
+)
+
+// FairLock 公平锁, 按照到达的顺序加锁
+// Client.Lock 的等待者各自按照 RetryStrategy 轮询, 谁先轮询到谁拿到锁, 竞争激烈时有的等待者会一直拿不到锁
+// FairLock 的等待者在 redis 的 list 中排队, 只有队头的等待者可以加锁
+//   - 等待者每次轮询都会延长自己的超时时间, 超过 waiterTimeout 没有轮询(例如进程崩溃)视为放弃, 到达队头时被清理
+//   - Lock 的 ctx 结束时主动离开队列
+//
+// 锁被释放之后, 队头的等待者最多在 pollInterval 之后拿到锁
+// 队头的等待者崩溃时, 锁最多空闲 waiterTimeout
+type FairLock struct {
+	c          redis.Cmdable
+	key        string
+	queueKey   string
+	timeoutKey string
+	token      string
+	expiration time.Duration
+
+	pollInterval  time.Duration
+	waiterTimeout time.Duration
+	stop          stopSignal
+}
+
+type FairLockOption func(l *FairLock)
+
+// WithPollInterval 等待者轮询的间隔, 默认为 50ms
+func WithPollInterval(interval time.Duration) FairLockOption {
+	return func(l *FairLock) {
+		l.pollInterval = interval
+	}
+}
+
+// WithWaiterTimeout 等待者超过 timeout 没有轮询就视为放弃, 必须大于轮询间隔, 默认为 1s
+func WithWaiterTimeout(timeout time.Duration) FairLockOption {
+	return func(l *FairLock) {
+		l.waiterTimeout = timeout
+	}
+}
+
+// NewFairLock 只创建锁, 不会加锁. 锁, 等待队列以及超时时间使用同一个 hash tag, 因此可以在集群模式下使用
+func (c *Client) NewFairLock(key string, expiration time.Duration, opts ...FairLockOption) *FairLock {
+	res := &FairLock{
+		c:             c.client,
+		key:           HashTag(key, ":lock"),
+		queueKey:      HashTag(key, ":queue"),
+		timeoutKey:    HashTag(key, ":timeouts"),
+		token:         uuid.New().String(),
+		expiration:    expiration,
+		pollInterval:  50 * time.Millisecond,
+		waiterTimeout: time.Second,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// Lock 排队直到加锁成功或者 ctx 结束, ctx 结束时离开队列
+// 超时以及主从切换期间的临时错误继续轮询, 其它错误离开队列之后返回
+func (l *FairLock) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+	for {
+		ok, err := l.tryLock(ctx)
+		if err == nil && ok {
+			return nil
+		}
+		if err != nil && !isRetryableErr(err) {
+			l.leave()
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			l.leave()
+			return ctx.Err()
+		}
+	}
+}
+
+// TryLock 只尝试一次, 锁被别人持有或者有人在排队时返回 ErrFailedToPreemptLock, 不会留在队列中
+func (l *FairLock) TryLock(ctx context.Context) error {
+	ok, err := l.tryLock(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.leave()
+		return ErrFailedToPreemptLock
+	}
+	return nil
+}
+
+func (l *FairLock) tryLock(ctx context.Context) (bool, error) {
+	lctx, cancel := context.WithTimeout(ctx, l.waiterTimeout)
+	defer cancel()
+	res, err := l.c.Eval(lctx, fairLockLua, l.keys(),
+		l.token, l.expiration.Milliseconds(), l.waiterTimeout.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (l *FairLock) keys() []string {
+	return []string{l.key, l.queueKey, l.timeoutKey}
+}
+
+// leave 离开队列, 失败时等待者会在 waiterTimeout 之后被清理, 所以忽略错误
+// 调用者的 ctx 可能已经结束, 使用新的 ctx
+func (l *FairLock) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.waiterTimeout)
+	defer cancel()
+	_ = l.c.Eval(ctx, fairLockLeaveLua, []string{l.queueKey, l.timeoutKey}, l.token).Err()
+}
+
+func (l *FairLock) Unlock(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, unLockLua, []string{l.key}, l.token).Int64()
+	defer l.stop.stop()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+func (l *FairLock) Refresh(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, refreshPXLua, []string{l.key}, l.token, l.expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// AutoRefresh 自动续期, 直到 Unlock
+func (l *FairLock) AutoRefresh(interval time.Duration, timeout time.Duration) error {
+	return autoRefresh(l.Refresh, l.stop.channel(), interval, timeout)
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFairLock_Lock(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(cmd *mocks.MockCmdable, l *FairLock)
+		timeout time.Duration
+		wantErr error
+	}{
+		{
+			name: "wait in queue",
+			mock: func(cmd *mocks.MockCmdable, l *FairLock) {
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), l.token, int64(60000), int64(1000)).
+						Return(evalResult(int64(0))).Times(2),
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), l.token, int64(60000), int64(1000)).
+						Return(evalResult(int64(1))),
+				)
+			},
+			timeout: time.Second,
+		},
+		{
+			name: "retry on readonly",
+			mock: func(cmd *mocks.MockCmdable, l *FairLock) {
+				first := evalResult(nil)
+				first.SetErr(redisErr("READONLY You can't write against a read only replica."))
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(first),
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(evalResult(int64(1))),
+				)
+			},
+			timeout: time.Second,
+		},
+		{
+			// ctx 结束时离开队列
+			name: "ctx done",
+			mock: func(cmd *mocks.MockCmdable, l *FairLock) {
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(evalResult(int64(0))).MinTimes(1)
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLeaveLua, []string{"{key1}:queue", "{key1}:timeouts"}, l.token).
+					Return(evalResult(int64(1)))
+			},
+			timeout: 20 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "eval error",
+			mock: func(cmd *mocks.MockCmdable, l *FairLock) {
+				res := evalResult(nil)
+				res.SetErr(redisErr("NOSCRIPT No matching script."))
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(res)
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLeaveLua, []string{"{key1}:queue", "{key1}:timeouts"}, l.token).
+					Return(evalResult(int64(1)))
+			},
+			timeout: time.Second,
+			wantErr: redisErr("NOSCRIPT No matching script."),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			l := NewClient(cmd).NewFairLock("key1", time.Minute, WithPollInterval(time.Millisecond))
+			tc.mock(cmd, l)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err := l.Lock(ctx)
+			assert.True(t, errors.Is(err, tc.wantErr))
+		})
+	}
+}
+
+func TestFairLock_TryLock(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewFairLock("key1", time.Minute)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(evalResult(int64(0))),
+		// 不会留在队列中
+		cmd.EXPECT().Eval(gomock.Any(), fairLockLeaveLua, []string{"{key1}:queue", "{key1}:timeouts"}, l.token).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), refreshPXLua, []string{"{key1}:lock"}, l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:lock"}, l.token).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:lock"}, l.token).
+			Return(evalResult(int64(0))),
+	)
+	assert.Equal(t, ErrFailedToPreemptLock, l.TryLock(ctx))
+	require.NoError(t, l.TryLock(ctx))
+	require.NoError(t, l.Refresh(ctx))
+	require.NoError(t, l.Unlock(ctx))
+	assert.Equal(t, ErrLockNotHold, l.Unlock(ctx))
+}
+
+func TestFairLock_RefreshMilliseconds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	// 不足一秒的过期时间不能被截断成 0
+	l := NewClient(cmd).NewFairLock("key1", 500*time.Millisecond)
+	cmd.EXPECT().Eval(gomock.Any(), refreshPXLua, []string{"{key1}:lock"}, l.token, int64(500)).
+		Return(evalResult(int64(0)))
+	assert.Equal(t, ErrLockNotHold, l.Refresh(context.Background()))
+}
+
+func TestFairLock_AutoRefreshRelock(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewFairLock("key1", time.Minute)
+	cmd.EXPECT().Eval(gomock.Any(), fairLockLua, l.keys(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(evalResult(int64(1))).Times(2)
+	cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:lock"}, l.token).
+		Return(evalResult(int64(1)))
+
+	require.NoError(t, l.TryLock(ctx))
+	done := make(chan error, 1)
+	go func() {
+		done <- l.AutoRefresh(time.Hour, time.Second)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, l.Unlock(ctx))
+	// 释放之后马上重新加锁, 上一次的 AutoRefresh 依旧要退出
+	require.NoError(t, l.TryLock(ctx))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("AutoRefresh 没有退出")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-redis/redis/v9"
 	"github.com/google/uuid"
 	"golang.org/x/sync/singleflight"
+	"sync"
 	"time"
 )
 
@@ -24,6 +25,16 @@ var (
 	lockLua string
 )
 
+// Client 分布式锁客户端
+//
+// 集群与哨兵:
+//   - 锁只涉及一个 key, lua 脚本只操作 KEYS[1], 因此可以直接使用 *redis.ClusterClient
+//   - 主从切换时, 加锁成功的写命令可能还没有同步到从节点, 从节点被提升之后锁就丢失了,
+//     其它客户端可以再次加锁. 这是 Redis 异步复制的固有问题, 对正确性要求高的场景
+//     需要配合 fencing token(例如数据库中的版本号)使用
+//   - 切换期间的 READONLY, LOADING, CLUSTERDOWN, TRYAGAIN 等错误会先由 go-redis 按照 MaxRetries 重试,
+//     重试耗尽之后 Lock 会把它们当作超时处理, 继续按照 RetryStrategy 重试
+//   - 锁丢失之后 Refresh 和 Unlock 返回 ErrLockNotHold
 type Client struct {
 	client redis.Cmdable
 	g      singleflight.Group
@@ -46,7 +57,7 @@ func (c *Client) SinglefightLock(ctx context.Context,
 		resChan := c.g.DoChan(key, func() (interface{}, error) {
 			// 只有一个goroutine会执行到这里
 			flag = true
-			return c.Lock(ctx, key, expiration, timeout, retry), nil
+			return c.Lock(ctx, key, expiration, timeout, retry)
 		})
 		select {
 		case res := <-resChan:
@@ -70,28 +81,41 @@ func (c *Client) Lock(ctx context.Context,
 	expiration time.Duration,
 	timeout time.Duration,
 	retry RetryStrategy) (*Lock, error) {
-	var timer *time.Timer
 	val := uuid.New().String()
+	err := retryLock(ctx, timeout, retry, func(ctx context.Context) (bool, error) {
+		res, err := c.client.Eval(ctx, lockLua, []string{key}, val, expiration.Seconds()).Result()
+		return res == "OK", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{
+		key:        key,
+		value:      val,
+		c:          c.client,
+		expiration: expiration,
+		stopCh:     make(chan struct{}, 1),
+	}, nil
+}
+
+// retryLock 反复执行 try 直到加锁成功, 每次执行的超时时间为 timeout
+// 超时以及主从切换期间的临时错误都继续重试, 重试间隔和次数由 retry 决定
+func retryLock(ctx context.Context, timeout time.Duration, retry RetryStrategy,
+	try func(ctx context.Context) (bool, error)) error {
+	var timer *time.Timer
 	for {
 		lctx, cancelFunc := context.WithTimeout(ctx, timeout)
-		res, err := c.client.Eval(lctx, lockLua, []string{key}, val, expiration.Seconds()).Result()
+		ok, err := try(lctx)
 		cancelFunc()
-		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
-			return nil, err
+		if err != nil && !isRetryableErr(err) {
+			return err
 		}
-
-		if res == "OK" {
-			return &Lock{
-				key:        key,
-				value:      val,
-				c:          c.client,
-				expiration: expiration,
-				stopCh:     make(chan struct{}, 1),
-			}, nil
+		if err == nil && ok {
+			return nil
 		}
 		interval, ok := retry.Next()
 		if !ok {
-			return nil, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
+			return fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
 		}
 		if timer == nil {
 			timer = time.NewTimer(interval)
@@ -101,7 +125,7 @@ func (c *Client) Lock(ctx context.Context,
 		select {
 		case <-timer.C:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
@@ -165,13 +189,20 @@ func (l *Lock) Refresh(ctx context.Context) error {
 
 // AutoRefresh 自动续期
 func (l *Lock) AutoRefresh(interval time.Duration, timeout time.Duration) error {
+	return autoRefresh(l.Refresh, l.stopCh, interval, timeout)
+}
+
+// autoRefresh 每隔 interval 执行一次 refresh, 超时之后立刻重试, 其它错误直接返回, 收到 stopCh 的信号之后退出
+func autoRefresh(refresh func(ctx context.Context) error, stopCh <-chan struct{},
+	interval time.Duration, timeout time.Duration) error {
 	timeoutCh := make(chan struct{}, 1)
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
-			err := l.Refresh(ctx)
+			err := refresh(ctx)
 			cancelFunc()
 			if errors.Is(err, context.DeadlineExceeded) {
 				timeoutCh <- struct{}{}
@@ -182,7 +213,7 @@ func (l *Lock) AutoRefresh(interval time.Duration, timeout time.Duration) error
 			}
 		case <-timeoutCh:
 			ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
-			err := l.Refresh(ctx)
+			err := refresh(ctx)
 			cancelFunc()
 			if errors.Is(err, context.DeadlineExceeded) {
 				timeoutCh <- struct{}{}
@@ -191,11 +222,41 @@ func (l *Lock) AutoRefresh(interval time.Duration, timeout time.Duration) error
 			if err != nil {
 				return err
 			}
-		case <-l.stopCh:
+		case <-stopCh:
 			return nil
 		}
 	}
 }
 
+// stopSignal 可以反复加锁的锁(ReentrantLock, RWLock, FairLock)用来停止 AutoRefresh
+// 一个 channel 对应一次持有锁, 最后一次释放时关闭, 之后的 AutoRefresh 使用新的 channel
+// 不能像 Lock 那样发送信号: 释放之后立刻重新加锁时, 旧的 AutoRefresh 可能还没有收到信号, 信号会被新一次加锁清理掉
+type stopSignal struct {
+	mutex  sync.Mutex
+	ch     chan struct{}
+	closed bool
+}
+
+// channel 当前这一次持有锁对应的 channel, 上一次的已经关闭时创建新的
+func (s *stopSignal) channel() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ch == nil || s.closed {
+		s.ch = make(chan struct{})
+		s.closed = false
+	}
+	return s.ch
+}
+
+// stop 通知这一次持有锁期间启动的所有 AutoRefresh 退出, 没有人调用 AutoRefresh 时什么也不做
+func (s *stopSignal) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ch != nil && !s.closed {
+		close(s.ch)
+		s.closed = true
+	}
+}
+
 // 使用方法
 // go l.AutoRefresh(1*time.Second, 10*time.Second)
@@ -4,6 +4,7 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -405,3 +406,107 @@ func getRdb() *redis.Client {
 	log.Println(res)
 	return rdb
 }
+
+func TestReentrantLock_e2e(t *testing.T) {
+	rdb := getRdb()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, rdb.Del(ctx, "reentrant-key").Err())
+
+	client := NewClient(rdb)
+	l := client.NewReentrantLock("reentrant-key", "", time.Minute)
+	require.NoError(t, l.TryLock(ctx))
+	// 同一个 owner 可以重入, 其它 owner 不行
+	require.NoError(t, client.NewReentrantLock("reentrant-key", l.Owner(), time.Minute).TryLock(ctx))
+	other := client.NewReentrantLock("reentrant-key", "", time.Minute)
+	assert.Equal(t, ErrFailedToPreemptLock, other.TryLock(ctx))
+	assert.Equal(t, ErrLockNotHold, other.Unlock(ctx))
+
+	require.NoError(t, l.Refresh(ctx))
+	require.NoError(t, l.Unlock(ctx))
+	assert.Equal(t, ErrFailedToPreemptLock, other.TryLock(ctx))
+	require.NoError(t, l.Unlock(ctx))
+	require.NoError(t, other.TryLock(ctx))
+	require.NoError(t, other.Unlock(ctx))
+	assert.Equal(t, ErrLockNotHold, l.Unlock(ctx))
+}
+
+func TestRWLock_e2e(t *testing.T) {
+	rdb := getRdb()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := NewClient(rdb)
+	r1 := client.NewRWLock("rwlock-key", time.Minute)
+	require.NoError(t, rdb.Del(ctx, r1.keys()...).Err())
+	retry := func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: 10 * time.Millisecond, MaxCnt: 3}
+	}
+
+	// 多个读者可以同时持有读锁
+	r2 := client.NewRWLock("rwlock-key", time.Minute)
+	require.NoError(t, r1.RLock(ctx, time.Second, retry()))
+	require.NoError(t, r2.RLock(ctx, time.Second, retry()))
+
+	// 写者等待期间新的读者无法加锁
+	w := client.NewRWLock("rwlock-key", time.Minute)
+	assert.True(t, errors.Is(w.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{}), ErrFailedToPreemptLock))
+	writeDone := make(chan error, 1)
+	go func() {
+		writeDone <- w.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: 10 * time.Millisecond, MaxCnt: 100})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	r3 := client.NewRWLock("rwlock-key", time.Minute)
+	assert.True(t, errors.Is(r3.RLock(ctx, time.Second, retry()), ErrFailedToPreemptLock))
+
+	require.NoError(t, r1.Refresh(ctx))
+	require.NoError(t, r1.RUnlock(ctx))
+	require.NoError(t, r2.RUnlock(ctx))
+	require.NoError(t, <-writeDone)
+	assert.True(t, errors.Is(r3.RLock(ctx, time.Second, retry()), ErrFailedToPreemptLock))
+	require.NoError(t, w.Unlock(ctx))
+	require.NoError(t, r3.RLock(ctx, time.Second, retry()))
+	require.NoError(t, r3.RUnlock(ctx))
+}
+
+func TestFairLock_e2e(t *testing.T) {
+	rdb := getRdb()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := NewClient(rdb)
+	newLock := func() *FairLock {
+		return client.NewFairLock("fair-key", time.Minute, WithPollInterval(10*time.Millisecond))
+	}
+	holder := newLock()
+	require.NoError(t, rdb.Del(ctx, holder.keys()...).Err())
+	require.NoError(t, holder.Lock(ctx))
+
+	// 放弃等待的等待者离开队列
+	cancelled := newLock()
+	cctx, ccancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, cancelled.Lock(cctx))
+	ccancel()
+
+	// 按照到达顺序加锁
+	order := make(chan int, 5)
+	waiters := make([]*FairLock, 5)
+	for i := range waiters {
+		i := i
+		waiters[i] = newLock()
+		go func() {
+			if err := waiters[i].Lock(ctx); err != nil {
+				order <- -1
+				return
+			}
+			order <- i
+			time.Sleep(20 * time.Millisecond)
+			_ = waiters[i].Unlock(ctx)
+		}()
+		time.Sleep(30 * time.Millisecond)
+	}
+	// 有人在排队时 TryLock 失败
+	assert.Equal(t, ErrFailedToPreemptLock, newLock().TryLock(ctx))
+	require.NoError(t, holder.Unlock(ctx))
+	for i := range waiters {
+		assert.Equal(t, i, <-order)
+	}
+}
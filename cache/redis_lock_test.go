@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"geek_cache/cache/mocks"
 	"github.com/go-redis/redis/v9"
 	"github.com/golang/mock/gomock"
@@ -76,6 +77,99 @@ func TestClient_TryLock(t *testing.T) {
 	}
 }
 
+func TestClient_Lock(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+		key  string
+
+		wantErr error
+	}{
+		{
+			name: "locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal("OK")
+				cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1"}, gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			key: "key1",
+		},
+		{
+			// 主从切换期间写到了从节点
+			name: "retry on readonly",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				first := redis.NewCmd(context.Background())
+				first.SetErr(redisErr("READONLY You can't write against a read only replica."))
+				res := redis.NewCmd(context.Background())
+				res.SetVal("OK")
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1"}, gomock.Any()).
+						Return(first),
+					cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1"}, gomock.Any()).
+						Return(res),
+				)
+				return cmd
+			},
+			key: "key1",
+		},
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(redisErr("NOSCRIPT No matching script."))
+				cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1"}, gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			key:     "key1",
+			wantErr: redisErr("NOSCRIPT No matching script."),
+		},
+		{
+			name: "retry exhausted",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal("")
+				cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1"}, gomock.Any()).
+					Return(res).Times(4)
+				return cmd
+			},
+			key:     "key1",
+			wantErr: ErrFailedToPreemptLock,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewClient(tc.mock(ctrl))
+			lock, err := client.Lock(context.Background(), tc.key, time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3})
+			assert.True(t, errors.Is(err, tc.wantErr))
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.key, lock.key)
+			assert.NotEmpty(t, lock.value)
+		})
+	}
+}
+
+// redisErr 模拟 redis 服务端返回的错误
+type redisErr string
+
+func (e redisErr) Error() string {
+	return string(e)
+}
+
+func (redisErr) RedisError() {}
+
 func TestLock_Unlock(t *testing.T) {
 	//ctrl := gomock.NewController(t)
 	//defer ctrl.Finish()
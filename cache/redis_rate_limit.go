@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	//go:embed lua/token_bucket.lua
+	tokenBucketLua string
+	//go:embed lua/fixed_window.lua
+	fixedWindowLua string
+	//go:embed lua/sliding_window.lua
+	slidingWindowLua string
+)
+
+// 分布式限流器, 所有实例共享同一个 redis key, 每次判断都是一次 lua 脚本调用
+// 令牌桶和滑动窗口使用 redis 服务端的时间(TIME 命令), 不受实例之间时钟偏差的影响, 需要 redis 5.0 及以上版本
+// 脚本只操作一个 key, 可以直接使用 *redis.ClusterClient
+
+// RedisTokenBucketLimiter 每秒生成 rate 个令牌, 最多积攒 burst 个
+type RedisTokenBucketLimiter struct {
+	client redis.Cmdable
+	key    string
+	rate   float64
+	burst  int
+}
+
+func NewRedisTokenBucketLimiter(client redis.Cmdable, key string, rate float64, burst int) (*RedisTokenBucketLimiter, error) {
+	if err := validateTokenBucketParams(rate, burst); err != nil {
+		return nil, err
+	}
+	return &RedisTokenBucketLimiter{
+		client: client,
+		key:    key,
+		rate:   rate,
+		burst:  burst,
+	}, nil
+}
+
+func (r *RedisTokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, r.reserve)
+}
+
+func (r *RedisTokenBucketLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, r.reserve)
+}
+
+func (r *RedisTokenBucketLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	return evalLimiter(ctx, r.client, tokenBucketLua, r.key, r.rate, r.burst)
+}
+
+// RedisFixedWindowLimiter 每个窗口内最多允许 limit 个请求, 窗口从第一个请求开始计算
+// 实现简单, 但是在两个窗口交界处最多可能通过 2*limit 个请求
+type RedisFixedWindowLimiter struct {
+	client redis.Cmdable
+	key    string
+	window time.Duration
+	limit  int
+}
+
+func NewRedisFixedWindowLimiter(client redis.Cmdable, key string, window time.Duration, limit int) (*RedisFixedWindowLimiter, error) {
+	if err := validateRedisWindowParams(window, limit); err != nil {
+		return nil, err
+	}
+	return &RedisFixedWindowLimiter{
+		client: client,
+		key:    key,
+		window: window,
+		limit:  limit,
+	}, nil
+}
+
+func (r *RedisFixedWindowLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, r.reserve)
+}
+
+func (r *RedisFixedWindowLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, r.reserve)
+}
+
+func (r *RedisFixedWindowLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	return evalLimiter(ctx, r.client, fixedWindowLua, r.key, r.window.Milliseconds(), r.limit)
+}
+
+// RedisSlidingWindowLimiter 任意 window 时间内最多允许 limit 个请求
+// 使用 zset 记录窗口内的每个请求, 精确但是内存占用与 limit 成正比
+type RedisSlidingWindowLimiter struct {
+	client redis.Cmdable
+	key    string
+	window time.Duration
+	limit  int
+}
+
+func NewRedisSlidingWindowLimiter(client redis.Cmdable, key string, window time.Duration, limit int) (*RedisSlidingWindowLimiter, error) {
+	if err := validateRedisWindowParams(window, limit); err != nil {
+		return nil, err
+	}
+	return &RedisSlidingWindowLimiter{
+		client: client,
+		key:    key,
+		window: window,
+		limit:  limit,
+	}, nil
+}
+
+func (r *RedisSlidingWindowLimiter) Allow(ctx context.Context) (bool, error) {
+	return allow(ctx, r.reserve)
+}
+
+func (r *RedisSlidingWindowLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, r.reserve)
+}
+
+func (r *RedisSlidingWindowLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	return evalLimiter(ctx, r.client, slidingWindowLua, r.key, r.window.Milliseconds(), r.limit, uuid.New().String())
+}
+
+// validateRedisWindowParams 脚本使用毫秒作为窗口的单位, 不足 1 毫秒的窗口会变成 0
+func validateRedisWindowParams(window time.Duration, limit int) error {
+	if window < time.Millisecond {
+		return fmt.Errorf("%w, window 不能小于 1ms, window: %s", ErrInvalidLimiterParams, window)
+	}
+	return validateWindowParams(window, limit)
+}
+
+// evalLimiter 限流脚本统一返回 {是否允许, 需要等待的毫秒数}
+func evalLimiter(ctx context.Context, client redis.Cmdable, script string, key string, args ...any) (time.Duration, error) {
+	res, err := client.Eval(ctx, script, []string{key}, args...).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 2 {
+		return 0, fmt.Errorf("cache: 限流脚本返回值错误 %v", res)
+	}
+	if res[0] == 1 {
+		return 0, nil
+	}
+	// 等待时间至少 1 毫秒, 避免 Wait 空转
+	if res[1] < 1 {
+		res[1] = 1
+	}
+	return time.Duration(res[1]) * time.Millisecond, nil
+}
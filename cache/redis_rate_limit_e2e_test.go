@@ -0,0 +1,66 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisLimiter_e2e(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	testCases := []struct {
+		name    string
+		key     string
+		limiter func() (Limiter, error)
+	}{
+		{
+			name: "token bucket",
+			key:  "limiter-token-bucket",
+			limiter: func() (Limiter, error) {
+				return NewRedisTokenBucketLimiter(client, "limiter-token-bucket", 10, 3)
+			},
+		},
+		{
+			name: "fixed window",
+			key:  "limiter-fixed-window",
+			limiter: func() (Limiter, error) {
+				return NewRedisFixedWindowLimiter(client, "limiter-fixed-window", time.Second, 3)
+			},
+		},
+		{
+			name: "sliding window",
+			key:  "limiter-sliding-window",
+			limiter: func() (Limiter, error) {
+				return NewRedisSlidingWindowLimiter(client, "limiter-sliding-window", time.Second, 3)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			require.NoError(t, client.Del(ctx, tc.key).Err())
+			defer client.Del(ctx, tc.key)
+			limiter, err := tc.limiter()
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				ok, er := limiter.Allow(ctx)
+				require.NoError(t, er)
+				assert.True(t, ok)
+			}
+			ok, err := limiter.Allow(ctx)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, limiter.Wait(ctx))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisLimiter_Allow(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter func(client redis.Cmdable) (Limiter, error)
+		mock    func(cmd *mocks.MockCmdable)
+		wantOK  bool
+		wantErr error
+	}{
+		{
+			name: "token bucket allowed",
+			limiter: func(client redis.Cmdable) (Limiter, error) {
+				return NewRedisTokenBucketLimiter(client, "limit", 10, 5)
+			},
+			mock: func(cmd *mocks.MockCmdable) {
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{int64(1), int64(0)})
+				cmd.EXPECT().Eval(gomock.Any(), tokenBucketLua, []string{"limit"}, float64(10), 5).Return(res)
+			},
+			wantOK: true,
+		},
+		{
+			name: "fixed window rejected",
+			limiter: func(client redis.Cmdable) (Limiter, error) {
+				return NewRedisFixedWindowLimiter(client, "limit", time.Second, 5)
+			},
+			mock: func(cmd *mocks.MockCmdable) {
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{int64(0), int64(300)})
+				cmd.EXPECT().Eval(gomock.Any(), fixedWindowLua, []string{"limit"}, int64(1000), 5).Return(res)
+			},
+		},
+		{
+			name: "sliding window",
+			limiter: func(client redis.Cmdable) (Limiter, error) {
+				return NewRedisSlidingWindowLimiter(client, "limit", time.Second, 5)
+			},
+			mock: func(cmd *mocks.MockCmdable) {
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{int64(1), int64(0)})
+				cmd.EXPECT().Eval(gomock.Any(), slidingWindowLua, []string{"limit"}, int64(1000), 5, gomock.Any()).Return(res)
+			},
+			wantOK: true,
+		},
+		{
+			name: "eval error",
+			limiter: func(client redis.Cmdable) (Limiter, error) {
+				return NewRedisFixedWindowLimiter(client, "limit", time.Second, 5)
+			},
+			mock: func(cmd *mocks.MockCmdable) {
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(gomock.Any(), fixedWindowLua, []string{"limit"}, int64(1000), 5).Return(res)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			tc.mock(cmd)
+			l, err := tc.limiter(cmd)
+			require.NoError(t, err)
+			ok, err := l.Allow(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantOK, ok)
+		})
+	}
+}
+
+func TestRedisLimiter_Wait(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	rejected := redis.NewCmd(context.Background())
+	rejected.SetVal([]any{int64(0), int64(20)})
+	allowed := redis.NewCmd(context.Background())
+	allowed.SetVal([]any{int64(1), int64(0)})
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), fixedWindowLua, []string{"limit"}, int64(1000), 1).Return(rejected),
+		cmd.EXPECT().Eval(gomock.Any(), fixedWindowLua, []string{"limit"}, int64(1000), 1).Return(allowed),
+	)
+	l, err := NewRedisFixedWindowLimiter(cmd, "limit", time.Second, 1)
+	require.NoError(t, err)
+	start := time.Now()
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestNewRedisLimiter_Invalid(t *testing.T) {
+	_, err := NewRedisTokenBucketLimiter(nil, "limit", 0, 5)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+	_, err = NewRedisTokenBucketLimiter(nil, "limit", 10, 0)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+	_, err = NewRedisFixedWindowLimiter(nil, "limit", time.Second, 0)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+	// 不足 1 毫秒的窗口在脚本中会变成 0
+	_, err = NewRedisFixedWindowLimiter(nil, "limit", time.Microsecond, 5)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+	_, err = NewRedisSlidingWindowLimiter(nil, "limit", time.Second, 0)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+	_, err = NewRedisSlidingWindowLimiter(nil, "limit", 0, 5)
+	assert.True(t, errors.Is(err, ErrInvalidLimiterParams))
+}
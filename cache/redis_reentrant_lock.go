@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	//go:embed lua/reentrant_lock.lua
+	reentrantLockLua string
+	//go:embed lua/reentrant_unlock.lua
+	reentrantUnlockLua string
+	//go:embed lua/reentrant_refresh.lua
+	reentrantRefreshLua string
+)
+
+// ReentrantLock 可重入的分布式锁, 持有者(owner)和重入次数保存在 redis 的 hash 中
+// 同一个 owner 可以重复加锁, 每次加锁都需要对应一次 Unlock, 最后一次 Unlock 才会真正释放锁
+// 同一个 ReentrantLock 可以在嵌套的调用中重复使用, 也可以把 owner 传给其它进程, 使用 Client.NewReentrantLock 重新创建
+type ReentrantLock struct {
+	c          redis.Cmdable
+	key        string
+	owner      string
+	expiration time.Duration
+	stop       stopSignal
+}
+
+// NewReentrantLock 只创建锁, 不会加锁. owner 为空时生成一个新的 owner
+func (c *Client) NewReentrantLock(key string, owner string, expiration time.Duration) *ReentrantLock {
+	if owner == "" {
+		owner = uuid.New().String()
+	}
+	return &ReentrantLock{
+		c:          c.client,
+		key:        key,
+		owner:      owner,
+		expiration: expiration,
+	}
+}
+
+// Owner 持有者标识, 使用相同 owner 的 ReentrantLock 可以重入
+func (l *ReentrantLock) Owner() string {
+	return l.owner
+}
+
+// Lock 与 Client.Lock 一样按照 retry 重试, timeout 为每次加锁的超时时间
+// 每次加锁都会把过期时间重置为 expiration
+// 所有的重试使用同一个加锁标识, 超时的那一次实际上已经成功时, 重试不会重复增加重入次数
+func (l *ReentrantLock) Lock(ctx context.Context, timeout time.Duration, retry RetryStrategy) error {
+	attempt := uuid.New().String()
+	return retryLock(ctx, timeout, retry, func(ctx context.Context) (bool, error) {
+		return l.tryLock(ctx, attempt)
+	})
+}
+
+// TryLock 锁被别人持有时返回 ErrFailedToPreemptLock
+func (l *ReentrantLock) TryLock(ctx context.Context) error {
+	ok, err := l.tryLock(ctx, uuid.New().String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrFailedToPreemptLock
+	}
+	return nil
+}
+
+func (l *ReentrantLock) tryLock(ctx context.Context, attempt string) (bool, error) {
+	res, err := l.c.Eval(ctx, reentrantLockLua, []string{l.key}, l.owner, l.expiration.Milliseconds(), attempt).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res > 0, nil
+}
+
+// Unlock 重入次数减一, 减到 0 时释放锁并停止 AutoRefresh
+func (l *ReentrantLock) Unlock(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, reentrantUnlockLua, []string{l.key}, l.owner).Int64()
+	if err != nil {
+		return err
+	}
+	if res > 0 {
+		return nil
+	}
+	l.stop.stop()
+	if res < 0 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+func (l *ReentrantLock) Refresh(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, reentrantRefreshLua, []string{l.key}, l.owner, l.expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// AutoRefresh 自动续期, 直到锁被最后一次 Unlock 释放
+func (l *ReentrantLock) AutoRefresh(interval time.Duration, timeout time.Duration) error {
+	return autoRefresh(l.Refresh, l.stop.channel(), interval, timeout)
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func evalResult(val any) *redis.Cmd {
+	res := redis.NewCmd(context.Background())
+	res.SetVal(val)
+	return res
+}
+
+func TestReentrantLock_Lock(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), reentrantLockLua, []string{"key1"}, "owner1", int64(60000), gomock.Any()).
+			Return(evalResult(int64(1))),
+		// 重入
+		cmd.EXPECT().Eval(gomock.Any(), reentrantLockLua, []string{"key1"}, "owner1", int64(60000), gomock.Any()).
+			Return(evalResult(int64(2))),
+		// 别人持有锁
+		cmd.EXPECT().Eval(gomock.Any(), reentrantLockLua, []string{"key1"}, gomock.Any(), int64(60000), gomock.Any()).
+			Return(evalResult(int64(0))).Times(3),
+	)
+	client := NewClient(cmd)
+	l := client.NewReentrantLock("key1", "owner1", time.Minute)
+	require.NoError(t, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	require.NoError(t, l.TryLock(ctx))
+
+	other := client.NewReentrantLock("key1", "", time.Minute)
+	assert.NotEmpty(t, other.Owner())
+	assert.NotEqual(t, l.Owner(), other.Owner())
+	err := other.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+	assert.True(t, errors.Is(err, ErrFailedToPreemptLock))
+}
+
+func TestReentrantLock_LockRetryAttempt(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	var attempts []any
+	record := func(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+		attempts = append(attempts, args[2])
+		if len(attempts) == 1 {
+			// 第一次在 redis 上已经执行成功, 但是客户端超时了
+			res := redis.NewCmd(ctx)
+			res.SetErr(context.DeadlineExceeded)
+			return res
+		}
+		return evalResult(int64(1))
+	}
+	cmd.EXPECT().Eval(gomock.Any(), reentrantLockLua, []string{"key1"}, "owner1", int64(60000), gomock.Any()).
+		DoAndReturn(record).Times(3)
+
+	l := NewClient(cmd).NewReentrantLock("key1", "owner1", time.Minute)
+	require.NoError(t, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	// 同一次 Lock 的重试使用同一个标识
+	require.Len(t, attempts, 2)
+	assert.Equal(t, attempts[0], attempts[1])
+	// 新的 Lock 使用新的标识
+	require.NoError(t, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	require.Len(t, attempts, 3)
+	assert.NotEqual(t, attempts[0], attempts[2])
+}
+
+func TestReentrantLock_Unlock(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   *redis.Cmd
+		wantErr  error
+		wantStop bool
+	}{
+		{
+			name:   "still held",
+			result: evalResult(int64(1)),
+		},
+		{
+			name:     "released",
+			result:   evalResult(int64(0)),
+			wantStop: true,
+		},
+		{
+			name:     "not hold",
+			result:   evalResult(int64(-1)),
+			wantErr:  ErrLockNotHold,
+			wantStop: true,
+		},
+		{
+			name: "eval error",
+			result: func() *redis.Cmd {
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				return res
+			}(),
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			cmd.EXPECT().Eval(context.Background(), reentrantUnlockLua, []string{"key1"}, "owner1").
+				Return(tc.result)
+			l := NewClient(cmd).NewReentrantLock("key1", "owner1", time.Minute)
+			stopCh := l.stop.channel()
+			err := l.Unlock(context.Background())
+			assert.True(t, errors.Is(err, tc.wantErr))
+			stopped := false
+			select {
+			case <-stopCh:
+				stopped = true
+			default:
+			}
+			assert.Equal(t, tc.wantStop, stopped)
+		})
+	}
+}
+
+func TestReentrantLock_AutoRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Eval(gomock.Any(), reentrantRefreshLua, []string{"key1"}, "owner1", int64(60000)).
+		Return(evalResult(int64(1))).MinTimes(1)
+	l := NewClient(cmd).NewReentrantLock("key1", "owner1", time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.AutoRefresh(5*time.Millisecond, time.Second)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), reentrantUnlockLua, []string{"key1"}, "owner1").
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), reentrantUnlockLua, []string{"key1"}, "owner1").
+			Return(evalResult(int64(0))),
+	)
+	// 还有一次重入, 继续续期
+	require.NoError(t, l.Unlock(context.Background()))
+	select {
+	case <-done:
+		t.Fatal("AutoRefresh 提前退出")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.NoError(t, l.Unlock(context.Background()))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("AutoRefresh 没有退出")
+	}
+
+	// 锁丢失之后 AutoRefresh 返回 ErrLockNotHold
+	cmd.EXPECT().Eval(gomock.Any(), reentrantRefreshLua, []string{"key1"}, "owner2", int64(60000)).
+		Return(evalResult(int64(0)))
+	lost := NewClient(cmd).NewReentrantLock("key1", "owner2", time.Minute)
+	assert.Equal(t, ErrLockNotHold, lost.AutoRefresh(time.Millisecond, time.Second))
+}
+
+func TestReentrantLock_AutoRefreshRelock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Eval(gomock.Any(), reentrantLockLua, []string{"key1"}, "owner1", int64(60000), gomock.Any()).
+		Return(evalResult(int64(1))).Times(2)
+	cmd.EXPECT().Eval(gomock.Any(), reentrantUnlockLua, []string{"key1"}, "owner1").
+		Return(evalResult(int64(0)))
+	cmd.EXPECT().Eval(gomock.Any(), reentrantRefreshLua, []string{"key1"}, "owner1", int64(60000)).
+		Return(evalResult(int64(1))).AnyTimes()
+	l := NewClient(cmd).NewReentrantLock("key1", "owner1", time.Minute)
+
+	require.NoError(t, l.TryLock(context.Background()))
+	done := make(chan error, 1)
+	go func() {
+		done <- l.AutoRefresh(time.Hour, time.Second)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// 释放之后立刻重新加锁, 上一次的 AutoRefresh 依旧要退出
+	require.NoError(t, l.Unlock(context.Background()))
+	require.NoError(t, l.TryLock(context.Background()))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("AutoRefresh 没有退出")
+	}
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRWLockHeld = errors.New("redis-lock: 已经持有读锁或者写锁")
+
+	//go:embed lua/rwlock_rlock.lua
+	rwLockRLockLua string
+	//go:embed lua/rwlock_runlock.lua
+	rwLockRUnlockLua string
+	//go:embed lua/rwlock_rrefresh.lua
+	rwLockRRefreshLua string
+	//go:embed lua/rwlock_lock.lua
+	rwLockLockLua string
+	//go:embed lua/refresh_px.lua
+	refreshPXLua string
+)
+
+const (
+	rwLockNone = iota
+	rwLockRead
+	rwLockWrite
+)
+
+// RWLock 分布式读写锁, 读锁可以被多个读者同时持有, 写锁与其它任何锁互斥
+//   - 写锁是一个普通的 string key, 值为写者标识, 与 Lock 一样
+//   - 读锁是一个 zset, member 为读者标识, score 为这个读者的过期时间, 过期的读者在下一次加锁时被清理
+//   - 写者加锁失败时会登记为等待中的写者, 之后新的读者无法加锁, 等已有的读者释放之后写者优先拿到锁
+//
+// 三个 key 使用同一个 hash tag, 因此可以在集群模式下使用
+// 每个 RWLock 同一时刻只能持有一把读锁或者写锁, 不同的 goroutine 需要使用不同的 RWLock
+type RWLock struct {
+	c          redis.Cmdable
+	writerKey  string
+	readersKey string
+	waitKey    string
+	token      string
+	expiration time.Duration
+
+	mutex sync.Mutex
+	mode  int
+	stop  stopSignal
+}
+
+func (c *Client) NewRWLock(key string, expiration time.Duration) *RWLock {
+	return &RWLock{
+		c:          c.client,
+		writerKey:  HashTag(key, ":writer"),
+		readersKey: HashTag(key, ":readers"),
+		waitKey:    HashTag(key, ":writer_waiting"),
+		token:      uuid.New().String(),
+		expiration: expiration,
+	}
+}
+
+// RLock 有写者持有锁或者正在等待时按照 retry 重试, timeout 为每次加锁的超时时间
+func (l *RWLock) RLock(ctx context.Context, timeout time.Duration, retry RetryStrategy) error {
+	return l.lock(ctx, rwLockRead, timeout, retry, func(ctx context.Context) (bool, error) {
+		res, err := l.c.Eval(ctx, rwLockRLockLua, l.keys(), l.token, l.expiration.Milliseconds()).Int64()
+		return res == 1, err
+	})
+}
+
+func (l *RWLock) RUnlock(ctx context.Context) error {
+	return l.unlock(ctx, rwLockRead, func(ctx context.Context) (int64, error) {
+		return l.c.Eval(ctx, rwLockRUnlockLua, []string{l.readersKey}, l.token).Int64()
+	})
+}
+
+// Lock 获取写锁, 重试耗尽或者 ctx 结束时撤销等待登记, 不再阻塞新的读者
+func (l *RWLock) Lock(ctx context.Context, timeout time.Duration, retry RetryStrategy) error {
+	err := l.lock(ctx, rwLockWrite, timeout, retry, func(ctx context.Context) (bool, error) {
+		res, err := l.c.Eval(ctx, rwLockLockLua, l.keys(), l.token, l.expiration.Milliseconds()).Int64()
+		return res == 1, err
+	})
+	if err != nil && !errors.Is(err, ErrRWLockHeld) {
+		// ctx 可能已经结束, 使用新的 ctx 撤销
+		cctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_ = l.c.Eval(cctx, unLockLua, []string{l.waitKey}, l.token).Err()
+		cancel()
+	}
+	return err
+}
+
+func (l *RWLock) Unlock(ctx context.Context) error {
+	return l.unlock(ctx, rwLockWrite, func(ctx context.Context) (int64, error) {
+		return l.c.Eval(ctx, unLockLua, []string{l.writerKey}, l.token).Int64()
+	})
+}
+
+// Refresh 续期当前持有的读锁或者写锁
+// 续期期间持有 mutex, 与 RUnlock/Unlock 互斥, AutoRefresh 不会在释放之后把锁续回来
+func (l *RWLock) Refresh(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var (
+		res int64
+		err error
+	)
+	switch l.mode {
+	case rwLockRead:
+		res, err = l.c.Eval(ctx, rwLockRRefreshLua, []string{l.readersKey}, l.token, l.expiration.Milliseconds()).Int64()
+	case rwLockWrite:
+		res, err = l.c.Eval(ctx, refreshPXLua, []string{l.writerKey}, l.token, l.expiration.Milliseconds()).Int64()
+	default:
+		return ErrLockNotHold
+	}
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// AutoRefresh 自动续期, 直到 RUnlock 或者 Unlock
+func (l *RWLock) AutoRefresh(interval time.Duration, timeout time.Duration) error {
+	stopCh := l.stop.channel()
+	err := autoRefresh(l.Refresh, stopCh, interval, timeout)
+	// 续期和释放锁并发执行时, 续期可能因为锁刚刚被释放而失败, 这时正常退出
+	// 释放锁时在 mutex 中关闭 stopCh, 所以续期失败时 stopCh 一定已经关闭
+	if errors.Is(err, ErrLockNotHold) {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+	}
+	return err
+}
+
+func (l *RWLock) keys() []string {
+	return []string{l.writerKey, l.readersKey, l.waitKey}
+}
+
+func (l *RWLock) lock(ctx context.Context, mode int, timeout time.Duration, retry RetryStrategy,
+	try func(ctx context.Context) (bool, error)) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.mode != rwLockNone {
+		return ErrRWLockHeld
+	}
+	if err := retryLock(ctx, timeout, retry, try); err != nil {
+		return err
+	}
+	l.mode = mode
+	return nil
+}
+
+func (l *RWLock) unlock(ctx context.Context, mode int, release func(ctx context.Context) (int64, error)) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.mode != mode {
+		return ErrLockNotHold
+	}
+	res, err := release(ctx)
+	if err != nil {
+		return err
+	}
+	l.mode = rwLockNone
+	l.stop.stop()
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRWLock_Keys(t *testing.T) {
+	l := NewClient(nil).NewRWLock("key1", time.Minute)
+	for _, key := range l.keys() {
+		assert.Equal(t, KeySlot("key1"), KeySlot(key))
+	}
+}
+
+func TestRWLock_Read(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	gomock.InOrder(
+		// 第一次有写者
+		cmd.EXPECT().Eval(gomock.Any(), rwLockRLockLua, l.keys(), l.token, int64(60000)).
+			Return(evalResult(int64(0))),
+		cmd.EXPECT().Eval(gomock.Any(), rwLockRLockLua, l.keys(), l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), rwLockRRefreshLua, []string{"{key1}:readers"}, l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), rwLockRUnlockLua, []string{"{key1}:readers"}, l.token).
+			Return(evalResult(int64(1))),
+	)
+	require.NoError(t, l.RLock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	// 同一个 RWLock 不能同时持有两把锁
+	assert.Equal(t, ErrRWLockHeld, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	assert.Equal(t, ErrLockNotHold, l.Unlock(ctx))
+	require.NoError(t, l.Refresh(ctx))
+	require.NoError(t, l.RUnlock(ctx))
+	assert.Equal(t, ErrLockNotHold, l.RUnlock(ctx))
+	assert.Equal(t, ErrLockNotHold, l.Refresh(ctx))
+}
+
+func TestRWLock_Write(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), rwLockLockLua, l.keys(), l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), refreshPXLua, []string{"{key1}:writer"}, l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:writer"}, l.token).
+			Return(evalResult(int64(1))),
+	)
+	require.NoError(t, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	assert.Equal(t, ErrLockNotHold, l.RUnlock(ctx))
+	require.NoError(t, l.Refresh(ctx))
+	require.NoError(t, l.Unlock(ctx))
+}
+
+func TestRWLock_LockGiveUp(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), rwLockLockLua, l.keys(), l.token, int64(60000)).
+			Return(evalResult(int64(0))).Times(3),
+		// 放弃之后撤销等待登记
+		cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:writer_waiting"}, l.token).
+			Return(evalResult(int64(1))),
+	)
+	err := l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+	assert.True(t, errors.Is(err, ErrFailedToPreemptLock))
+	assert.Equal(t, ErrLockNotHold, l.Unlock(ctx))
+}
+
+func TestRWLock_AutoRefresh(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	cmd.EXPECT().Eval(gomock.Any(), rwLockRLockLua, l.keys(), l.token, int64(60000)).
+		Return(evalResult(int64(1)))
+	cmd.EXPECT().Eval(gomock.Any(), rwLockRRefreshLua, []string{"{key1}:readers"}, l.token, int64(60000)).
+		Return(evalResult(int64(1))).MinTimes(1)
+	cmd.EXPECT().Eval(gomock.Any(), rwLockRUnlockLua, []string{"{key1}:readers"}, l.token).
+		Return(evalResult(int64(1)))
+
+	require.NoError(t, l.RLock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	done := make(chan error, 1)
+	go func() {
+		done <- l.AutoRefresh(5*time.Millisecond, time.Second)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, l.RUnlock(ctx))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("AutoRefresh 没有退出")
+	}
+}
+
+func TestRWLock_AutoRefreshLost(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), rwLockLockLua, l.keys(), l.token, int64(60000)).
+			Return(evalResult(int64(1))),
+		// 锁已经过期被别人拿走, 没有 Unlock 的信号, 需要返回错误
+		cmd.EXPECT().Eval(gomock.Any(), refreshPXLua, []string{"{key1}:writer"}, l.token, int64(60000)).
+			Return(evalResult(int64(0))),
+	)
+	require.NoError(t, l.Lock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	assert.Equal(t, ErrLockNotHold, l.AutoRefresh(time.Millisecond, time.Second))
+}
+
+func TestRWLock_AutoRefreshRelock(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	l := NewClient(cmd).NewRWLock("key1", time.Minute)
+	cmd.EXPECT().Eval(gomock.Any(), rwLockRLockLua, l.keys(), l.token, int64(60000)).
+		Return(evalResult(int64(1))).Times(2)
+	cmd.EXPECT().Eval(gomock.Any(), rwLockRUnlockLua, []string{"{key1}:readers"}, l.token).
+		Return(evalResult(int64(1)))
+
+	require.NoError(t, l.RLock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	done := make(chan error, 1)
+	go func() {
+		done <- l.AutoRefresh(time.Hour, time.Second)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, l.RUnlock(ctx))
+	// 释放之后马上重新加锁, 上一次的 AutoRefresh 依旧要退出
+	require.NoError(t, l.RLock(ctx, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("AutoRefresh 没有退出")
+	}
+}
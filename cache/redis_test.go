@@ -130,6 +130,20 @@ func TestRedisCache_Get(t *testing.T) {
 			key:     "key1",
 			wantErr: context.DeadlineExceeded,
 		},
+		{
+			name: "key not found",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				str := redis.NewStringCmd(context.Background())
+				str.SetErr(redis.Nil)
+				cmd.EXPECT().
+					Get(context.Background(), "key1").
+					Return(str)
+				return cmd
+			},
+			key:     "key1",
+			wantErr: fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, "key1"),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -147,6 +161,140 @@ func TestRedisCache_Get(t *testing.T) {
 	}
 }
 
+func TestRedisCache_Codec(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	data := []byte(`{"Name":"Tom","Age":18}`)
+	cmd.EXPECT().
+		Set(context.Background(), "key1", data, time.Minute).
+		Return(redis.NewStatusResult("OK", nil))
+	cmd.EXPECT().
+		Get(context.Background(), "key1").
+		Return(redis.NewStringResult(string(data), nil)).Times(2)
+
+	c := NewRedisCache(cmd, WithCodec(JSONCodec{}))
+	err := c.Set(context.Background(), "key1", codecUser{Name: "Tom", Age: 18}, time.Minute)
+	require.NoError(t, err)
+	val, err := c.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, data, val)
+	u, err := GetAs[codecUser](context.Background(), c, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, codecUser{Name: "Tom", Age: 18}, u)
+}
+
+func TestGetAs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		opts    []RedisCacheOption
+		wantVal int
+		wantErr error
+	}{
+		{
+			name: "scan",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Get(context.Background(), "key1").
+					Return(redis.NewStringResult("12", nil))
+				return cmd
+			},
+			wantVal: 12,
+		},
+		{
+			name: "json",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Get(context.Background(), "key1").
+					Return(redis.NewStringResult("12", nil))
+				return cmd
+			},
+			opts:    []RedisCacheOption{WithCodec(JSONCodec{})},
+			wantVal: 12,
+		},
+		{
+			name: "timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Get(context.Background(), "key1").
+					Return(redis.NewStringResult("", context.DeadlineExceeded))
+				return cmd
+			},
+			opts:    []RedisCacheOption{WithCodec(JSONCodec{})},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewRedisCache(tc.mock(ctrl), tc.opts...)
+			val, err := GetAs[int](context.Background(), c, "key1")
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+}
+
+func TestRedisCache_GetMulti(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		keys    []string
+		wantVal map[string]any
+		wantErr error
+	}{
+		{
+			name: "get multi",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().MGet(context.Background(), "key1", "key2").
+					Return(redis.NewSliceResult([]any{"val1", nil}, nil))
+				return cmd
+			},
+			keys:    []string{"key1", "key2"},
+			wantVal: map[string]any{"key1": "val1"},
+		},
+		{
+			name: "timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().MGet(context.Background(), "key1").
+					Return(redis.NewSliceResult(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			keys:    []string{"key1"},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "empty keys",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mocks.NewMockCmdable(ctrl)
+			},
+			wantVal: map[string]any{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewRedisCache(tc.mock(ctrl))
+			val, err := c.GetMulti(context.Background(), tc.keys)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+}
+
 func TestReadThrough_Get(t *testing.T) {
 	testCases := []struct {
 		name        string
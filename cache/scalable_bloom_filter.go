@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ScalableBloomFilter 可扩容的布隆过滤器, 由多层 BitBloomFilter 组成
+// 当前层的元素个数达到容量时新增一层, 容量为上一层的 growth 倍, 误判率为上一层的 ratio 倍,
+// 因此总的误判率不超过 fpRate. 与 BitBloomFilter 一样不支持删除
+type ScalableBloomFilter struct {
+	mutex  sync.RWMutex
+	layers []*bloomLayer
+
+	initial uint64
+	fpRate  float64
+	growth  uint64
+	ratio   float64
+}
+
+type bloomLayer struct {
+	filter   *BitBloomFilter
+	capacity uint64
+	count    uint64
+}
+
+type ScalableBloomFilterOption func(s *ScalableBloomFilter)
+
+// WithGrowth 新增的层的容量是上一层的 growth 倍, 默认为 2, 不能小于 1
+func WithGrowth(growth uint64) ScalableBloomFilterOption {
+	return func(s *ScalableBloomFilter) {
+		s.growth = growth
+	}
+}
+
+// WithTighteningRatio 新增的层的误判率是上一层的 ratio 倍, 默认为 0.5, 必须在 (0, 1) 之间
+func WithTighteningRatio(ratio float64) ScalableBloomFilterOption {
+	return func(s *ScalableBloomFilter) {
+		s.ratio = ratio
+	}
+}
+
+// NewScalableBloomFilter initialItems 为第一层的容量, 必须大于 0, fpRate 为总的误判率, 必须在 (0, 1) 之间
+func NewScalableBloomFilter(initialItems uint64, fpRate float64, opts ...ScalableBloomFilterOption) (*ScalableBloomFilter, error) {
+	res := &ScalableBloomFilter{
+		initial: initialItems,
+		fpRate:  fpRate,
+		growth:  2,
+		ratio:   0.5,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if err := validateScalableParams(res.initial, res.fpRate, res.growth, res.ratio); err != nil {
+		return nil, err
+	}
+	res.addLayer()
+	return res, nil
+}
+
+// validateScalableParams 容量为 0 时每次 Add 都会新增一层, 误判率不在 (0, 1) 之间时无法计算位数组的大小
+func validateScalableParams(initial uint64, fpRate float64, growth uint64, ratio float64) error {
+	if initial == 0 {
+		return fmt.Errorf("%w, 初始容量必须大于 0", ErrInvalidFilterParams)
+	}
+	if err := validateFPRate(fpRate); err != nil {
+		return err
+	}
+	if growth < 1 {
+		return fmt.Errorf("%w, 增长倍数不能小于 1", ErrInvalidFilterParams)
+	}
+	if !(ratio > 0 && ratio < 1) {
+		return fmt.Errorf("%w, 收紧比例 %v 必须在 (0, 1) 之间", ErrInvalidFilterParams, ratio)
+	}
+	return nil
+}
+
+func (s *ScalableBloomFilter) Add(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 已经存在的 key 不计数, 否则重复添加会导致过早扩容
+	if s.test(ctx, key) {
+		return nil
+	}
+	last := s.layers[len(s.layers)-1]
+	if last.count >= last.capacity {
+		last = s.addLayer()
+	}
+	last.count++
+	return last.filter.Add(ctx, key)
+}
+
+func (s *ScalableBloomFilter) AddMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		_ = s.Add(ctx, key)
+	}
+	return nil
+}
+
+func (s *ScalableBloomFilter) Test(ctx context.Context, key string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.test(ctx, key), nil
+}
+
+// Layers 当前的层数
+func (s *ScalableBloomFilter) Layers() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.layers)
+}
+
+func (s *ScalableBloomFilter) test(ctx context.Context, key string) bool {
+	for _, layer := range s.layers {
+		if ok, _ := layer.filter.Test(ctx, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addLayer 第 i 层的容量为 initial*growth^i, 误判率为 fpRate*(1-ratio)*ratio^i
+func (s *ScalableBloomFilter) addLayer() *bloomLayer {
+	i := len(s.layers)
+	capacity := s.initial * uint64(math.Pow(float64(s.growth), float64(i)))
+	fpRate := s.fpRate * (1 - s.ratio) * math.Pow(s.ratio, float64(i))
+	layer := &bloomLayer{
+		// 每一层的误判率都在 (0, fpRate) 之间, 不需要再次校验
+		filter:   newBitBloomFilter(capacity, fpRate),
+		capacity: capacity,
+	}
+	s.layers = append(s.layers, layer)
+	return layer
+}
+
+type scalableHeader struct {
+	Kind    byte
+	Initial uint64
+	FPRate  float64
+	Growth  uint64
+	Ratio   float64
+	Layers  uint32
+}
+
+type layerHeader struct {
+	Capacity uint64
+	Count    uint64
+	Size     uint32
+}
+
+// MarshalBinary 格式: 头部 + 每一层的容量(8), 元素个数(8), 数据长度(4) 以及 BitBloomFilter 序列化的数据
+func (s *ScalableBloomFilter) MarshalBinary() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, scalableHeader{
+		Kind:    scalableBloomFilterKind,
+		Initial: s.initial,
+		FPRate:  s.fpRate,
+		Growth:  s.growth,
+		Ratio:   s.ratio,
+		Layers:  uint32(len(s.layers)),
+	})
+	for _, layer := range s.layers {
+		data, err := layer.filter.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		_ = binary.Write(&buf, binary.BigEndian, layerHeader{
+			Capacity: layer.capacity,
+			Count:    layer.count,
+			Size:     uint32(len(data)),
+		})
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *ScalableBloomFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	var header scalableHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("%w, 原因：%s", ErrInvalidFilterData, err.Error())
+	}
+	if header.Kind != scalableBloomFilterKind || header.Layers == 0 {
+		return ErrInvalidFilterData
+	}
+	if err := validateScalableParams(header.Initial, header.FPRate, header.Growth, header.Ratio); err != nil {
+		return fmt.Errorf("%w, 原因：%s", ErrInvalidFilterData, err.Error())
+	}
+	// 每一层至少有一个 layerHeader, 避免根据错误的层数分配过大的内存
+	if uint64(header.Layers)*uint64(binary.Size(layerHeader{})) > uint64(r.Len()) {
+		return ErrInvalidFilterData
+	}
+	layers := make([]*bloomLayer, 0, header.Layers)
+	for i := uint32(0); i < header.Layers; i++ {
+		var lh layerHeader
+		if err := binary.Read(r, binary.BigEndian, &lh); err != nil {
+			return fmt.Errorf("%w, 原因：%s", ErrInvalidFilterData, err.Error())
+		}
+		if uint64(lh.Size) > uint64(r.Len()) {
+			return ErrInvalidFilterData
+		}
+		layerData := make([]byte, lh.Size)
+		_, _ = r.Read(layerData)
+		filter := &BitBloomFilter{}
+		if err := filter.UnmarshalBinary(layerData); err != nil {
+			return err
+		}
+		layers = append(layers, &bloomLayer{filter: filter, capacity: lh.Capacity, count: lh.Count})
+	}
+	if r.Len() != 0 {
+		return ErrInvalidFilterData
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.initial, s.fpRate, s.growth, s.ratio = header.Initial, header.FPRate, header.Growth, header.Ratio
+	s.layers = layers
+	return nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestScalableBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewScalableBloomFilter(100, 0.01)
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.Layers())
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	require.NoError(t, f.AddMulti(ctx, keys))
+	// 100 + 200 + 400 + 800
+	assert.Equal(t, 4, f.Layers())
+
+	for _, key := range keys {
+		ok, err := f.Test(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if ok, _ := f.Test(ctx, fmt.Sprintf("other-%d", i)); ok {
+			fp++
+		}
+	}
+	assert.Less(t, fp, 200)
+
+	// 重复添加不会导致扩容
+	require.NoError(t, f.AddMulti(ctx, keys))
+	assert.Equal(t, 4, f.Layers())
+}
+
+func TestNewScalableBloomFilter_Invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		initial uint64
+		fpRate  float64
+		opts    []ScalableBloomFilterOption
+	}{
+		{name: "zero initial", initial: 0, fpRate: 0.01},
+		{name: "zero fp rate", initial: 100, fpRate: 0},
+		{name: "fp rate too large", initial: 100, fpRate: 1},
+		{name: "zero growth", initial: 100, fpRate: 0.01, opts: []ScalableBloomFilterOption{WithGrowth(0)}},
+		{name: "invalid ratio", initial: 100, fpRate: 0.01, opts: []ScalableBloomFilterOption{WithTighteningRatio(1)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewScalableBloomFilter(tc.initial, tc.fpRate, tc.opts...)
+			assert.True(t, errors.Is(err, ErrInvalidFilterParams))
+		})
+	}
+}
+
+func TestScalableBloomFilter_UnmarshalBinary(t *testing.T) {
+	f, err := NewScalableBloomFilter(10, 0.01)
+	require.NoError(t, err)
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+
+	// 层数远大于数据长度, 不能按照层数分配内存
+	var header scalableHeader
+	require.NoError(t, binary.Read(bytes.NewReader(data), binary.BigEndian, &header))
+	header.Layers = math.MaxUint32
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, header))
+	buf.Write(data[binary.Size(header):])
+	assert.True(t, errors.Is((&ScalableBloomFilter{}).UnmarshalBinary(buf.Bytes()), ErrInvalidFilterData))
+
+	// 参数错误
+	header.Layers = 1
+	header.Initial = 0
+	buf.Reset()
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, header))
+	buf.Write(data[binary.Size(header):])
+	assert.True(t, errors.Is((&ScalableBloomFilter{}).UnmarshalBinary(buf.Bytes()), ErrInvalidFilterData))
+}
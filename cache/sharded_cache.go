@@ -0,0 +1,314 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"golang.org/x/sync/errgroup"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoShard = errors.New("cache: 没有可用的分片")
+)
+
+// hashRing 一致性哈希环
+// 每个节点对应 replicas 个虚拟节点, 增删节点时只有相邻区间的 key 会被重新映射
+type hashRing struct {
+	replicas int
+	hash     func(data []byte) uint32
+	// 有序的虚拟节点哈希值
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+func newHashRing(replicas int, hash func(data []byte) uint32) *hashRing {
+	return &hashRing{
+		replicas: replicas,
+		hash:     hash,
+		nodes:    map[uint32]string{},
+	}
+}
+
+func (h *hashRing) add(node string) {
+	for i := 0; i < h.replicas; i++ {
+		hash := h.hash([]byte(node + "#" + strconv.Itoa(i)))
+		// 哈希冲突时保留先加入的节点
+		if _, ok := h.nodes[hash]; ok {
+			continue
+		}
+		h.nodes[hash] = node
+		h.hashes = append(h.hashes, hash)
+	}
+	sort.Slice(h.hashes, func(i, j int) bool {
+		return h.hashes[i] < h.hashes[j]
+	})
+}
+
+func (h *hashRing) remove(node string) {
+	hashes := h.hashes[:0]
+	for _, hash := range h.hashes {
+		if h.nodes[hash] == node {
+			delete(h.nodes, hash)
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	h.hashes = hashes
+}
+
+// get 顺时针找到第一个虚拟节点
+func (h *hashRing) get(key string) (string, bool) {
+	if len(h.hashes) == 0 {
+		return "", false
+	}
+	hash := h.hash([]byte(key))
+	idx := sort.Search(len(h.hashes), func(i int) bool {
+		return h.hashes[i] >= hash
+	})
+	if idx == len(h.hashes) {
+		idx = 0
+	}
+	return h.nodes[h.hashes[idx]], true
+}
+
+var defaultShardHash = crc32.ChecksumIEEE
+
+// ShardedCache 客户端分片, 使用一致性哈希把 key 路由到多个缓存(一般是多个 RedisCache)
+type ShardedCache struct {
+	mutex  sync.RWMutex
+	ring   *hashRing
+	shards map[string]Cache
+
+	replicas int
+	hash     func(data []byte) uint32
+}
+
+type ShardedCacheOption func(s *ShardedCache)
+
+// WithVirtualNodes 每个分片的虚拟节点数量, 越多分布越均匀
+func WithVirtualNodes(replicas int) ShardedCacheOption {
+	return func(s *ShardedCache) {
+		s.replicas = replicas
+	}
+}
+
+func WithShardHash(hash func(data []byte) uint32) ShardedCacheOption {
+	return func(s *ShardedCache) {
+		s.hash = hash
+	}
+}
+
+// NewShardedCache shards 的 key 为分片名字, 同一个分片在所有实例上的名字必须一致
+func NewShardedCache(shards map[string]Cache, opts ...ShardedCacheOption) *ShardedCache {
+	res := &ShardedCache{
+		shards:   make(map[string]Cache, len(shards)),
+		replicas: 160,
+		hash:     defaultShardHash,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.ring = newHashRing(res.replicas, res.hash)
+	for name, c := range shards {
+		res.shards[name] = c
+		res.ring.add(name)
+	}
+	return res
+}
+
+// AddShard 已经存在时替换
+func (s *ShardedCache) AddShard(name string, c Cache) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.shards[name]; !ok {
+		s.ring.add(name)
+	}
+	s.shards[name] = c
+}
+
+func (s *ShardedCache) RemoveShard(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.shards[name]; !ok {
+		return
+	}
+	delete(s.shards, name)
+	s.ring.remove(name)
+}
+
+// Shard 返回 key 所在的分片名字
+func (s *ShardedCache) Shard(key string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	name, ok := s.ring.get(key)
+	if !ok {
+		return "", ErrNoShard
+	}
+	return name, nil
+}
+
+func (s *ShardedCache) shard(key string) (Cache, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	name, ok := s.ring.get(key)
+	if !ok {
+		return nil, ErrNoShard
+	}
+	return s.shards[name], nil
+}
+
+func (s *ShardedCache) Get(ctx context.Context, key string) (any, error) {
+	c, err := s.shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, key)
+}
+
+func (s *ShardedCache) Set(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, value, expireTime)
+}
+
+func (s *ShardedCache) Delete(ctx context.Context, key string) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, key)
+}
+
+func (s *ShardedCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	c, err := s.shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.LoadAndDelete(ctx, key)
+}
+
+// group 按照分片对 key 进行分组
+func (s *ShardedCache) group(keys []string) (map[string][]string, map[string]Cache, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	groups := map[string][]string{}
+	shards := map[string]Cache{}
+	for _, key := range keys {
+		name, ok := s.ring.get(key)
+		if !ok {
+			return nil, nil, ErrNoShard
+		}
+		groups[name] = append(groups[name], key)
+		shards[name] = s.shards[name]
+	}
+	return groups, shards, nil
+}
+
+// GetMulti 按分片拆分之后并发读取, 分片实现了 BatchCache 时使用批量接口
+func (s *ShardedCache) GetMulti(ctx context.Context, keys []string) (map[string]any, error) {
+	groups, shards, err := s.group(keys)
+	if err != nil {
+		return nil, err
+	}
+	var mutex sync.Mutex
+	res := make(map[string]any, len(keys))
+	var eg errgroup.Group
+	for name, ks := range groups {
+		c, ks := shards[name], ks
+		eg.Go(func() error {
+			vals, er := getMulti(ctx, c, ks)
+			if er != nil {
+				return er
+			}
+			mutex.Lock()
+			for k, v := range vals {
+				res[k] = v
+			}
+			mutex.Unlock()
+			return nil
+		})
+	}
+	if err = eg.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *ShardedCache) SetMulti(ctx context.Context, kvs map[string]any, expireTime time.Duration) error {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	groups, shards, err := s.group(keys)
+	if err != nil {
+		return err
+	}
+	var eg errgroup.Group
+	for name, ks := range groups {
+		c := shards[name]
+		sub := make(map[string]any, len(ks))
+		for _, k := range ks {
+			sub[k] = kvs[k]
+		}
+		eg.Go(func() error {
+			if bc, ok := c.(BatchCache); ok {
+				return bc.SetMulti(ctx, sub, expireTime)
+			}
+			for k, v := range sub {
+				if er := c.Set(ctx, k, v, expireTime); er != nil {
+					return er
+				}
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func (s *ShardedCache) DeleteMulti(ctx context.Context, keys []string) error {
+	groups, shards, err := s.group(keys)
+	if err != nil {
+		return err
+	}
+	var eg errgroup.Group
+	for name, ks := range groups {
+		c, ks := shards[name], ks
+		eg.Go(func() error {
+			if bc, ok := c.(BatchCache); ok {
+				return bc.DeleteMulti(ctx, ks)
+			}
+			for _, k := range ks {
+				if er := c.Delete(ctx, k); er != nil {
+					return er
+				}
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func getMulti(ctx context.Context, c Cache, keys []string) (map[string]any, error) {
+	if bc, ok := c.(BatchCache); ok {
+		return bc.GetMulti(ctx, keys)
+	}
+	res := make(map[string]any, len(keys))
+	for _, k := range keys {
+		val, err := c.Get(ctx, k)
+		if errors.Is(err, errs.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[k] = val
+	}
+	return res, nil
+}
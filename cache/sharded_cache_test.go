@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHashRing(t *testing.T) {
+	ring := newHashRing(160, defaultShardHash)
+	_, ok := ring.get("key1")
+	assert.False(t, ok)
+
+	ring.add("node1")
+	ring.add("node2")
+	ring.add("node3")
+	before := map[string]string{}
+	cnt := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		node, ok := ring.get(key)
+		require.True(t, ok)
+		before[key] = node
+		cnt[node]++
+	}
+	// 虚拟节点保证分布大致均匀
+	for _, node := range []string{"node1", "node2", "node3"} {
+		assert.Greater(t, cnt[node], 2000)
+	}
+
+	// 加入新节点, 只有被新节点接管的 key 发生变化
+	ring.add("node4")
+	moved := 0
+	for key, node := range before {
+		now, _ := ring.get(key)
+		if now != node {
+			assert.Equal(t, "node4", now)
+			moved++
+		}
+	}
+	assert.Less(t, moved, 4000)
+
+	// 删除节点, 其它节点上的 key 不变
+	ring.remove("node4")
+	for key, node := range before {
+		now, _ := ring.get(key)
+		assert.Equal(t, node, now)
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	ctx := context.Background()
+	shards := map[string]Cache{
+		"shard1": NewBuildInMapCache(time.Minute),
+		"shard2": NewBuildInMapCache(time.Minute),
+	}
+	c := NewShardedCache(shards)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, time.Minute))
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		name, err := c.Shard(key)
+		require.NoError(t, err)
+		val, err := shards[name].Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, i, val)
+	}
+
+	val, err := c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+	require.NoError(t, c.Delete(ctx, "key2"))
+	_, err = c.Get(ctx, "key2")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+
+	c.RemoveShard("shard1")
+	c.RemoveShard("shard2")
+	_, err = c.Get(ctx, "key3")
+	assert.Equal(t, ErrNoShard, err)
+	c.AddShard("shard1", shards["shard1"])
+	name, err := c.Shard("key3")
+	require.NoError(t, err)
+	assert.Equal(t, "shard1", name)
+}
+
+func TestShardedCache_Multi(t *testing.T) {
+	ctx := context.Background()
+	c := NewShardedCache(map[string]Cache{
+		"shard1": NewBuildInMapCache(time.Minute),
+		"shard2": NewBuildInMapCache(time.Minute),
+		"shard3": NewBuildInMapCache(time.Minute),
+	}, WithVirtualNodes(50))
+	kvs := map[string]any{}
+	keys := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		kvs[key] = i
+		keys = append(keys, key)
+	}
+	require.NoError(t, c.SetMulti(ctx, kvs, time.Minute))
+	res, err := c.GetMulti(ctx, append(keys, "not exist"))
+	require.NoError(t, err)
+	assert.Equal(t, kvs, res)
+
+	require.NoError(t, c.DeleteMulti(ctx, keys[:10]))
+	res, err = c.GetMulti(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, res, 10)
+}
@@ -3,11 +3,103 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"geek_cache/internal/errs"
-	"golang.org/x/sync/singleflight"
+	"runtime/debug"
+	"sync"
+	"time"
 )
 
+var (
+	ErrLoadPanic = errors.New("cache: 加载数据时发生 panic")
+)
+
+// defaultLoadTimeout 没有配置超时时间时, 合并之后的加载最多执行的时间
+const defaultLoadTimeout = 5 * time.Second
+
+// loadGroup 合并同一个 key 的并发加载, 与 singleflight.Group 的区别:
+//   - 加载在独立的 goroutine 中执行, 使用与调用方分离的 ctx(保留 ctx 中的值, 但是不会被取消)和自己的超时时间,
+//     第一个调用方被取消不会影响其它调用方
+//   - 每个调用方只等待到自己的 ctx 过期为止
+//   - 加载时的 panic 转换为 ErrLoadPanic 返回给所有调用方
+//
+// 零值可以直接使用
+type loadGroup struct {
+	mutex sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+func (g *loadGroup) Do(ctx context.Context, key string, timeout time.Duration,
+	fn func(ctx context.Context) (any, error)) (any, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*loadCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &loadCall{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.load(detachedContext{parent: ctx}, key, timeout, c, fn)
+	}
+	g.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *loadGroup) load(ctx context.Context, key string, timeout time.Duration,
+	c *loadCall, fn func(ctx context.Context) (any, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.val = nil
+			c.err = fmt.Errorf("%w, key: %s, panic: %v\n%s", ErrLoadPanic, key, r, debug.Stack())
+		}
+		// 先删除再通知, 结果返回之后的调用会重新加载
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(c.done)
+	}()
+	if timeout <= 0 {
+		timeout = defaultLoadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.val, c.err = fn(ctx)
+}
+
+// detachedContext 保留 parent 中的值(例如链路追踪信息), 但是没有 parent 的过期时间和取消信号
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key any) any {
+	return d.parent.Value(key)
+}
+
 // SingleflightCacheV1 装饰器模式
 // 进一步封装 ReadThrough
 // 非侵入式
@@ -15,40 +107,59 @@ type SingleflightCacheV1 struct {
 	ReadThrough
 }
 
-func NewSinglflightCache(cache Cache, loadFunc func(ctx context.Context, key string) (any, error)) *SingleflightCacheV1 {
-	g := &singleflight.Group{}
+type SingleflightOption func(s *singleflightConfig)
+
+type singleflightConfig struct {
+	loadTimeout time.Duration
+}
+
+// WithLoadTimeout 合并之后的加载使用的超时时间, 与调用方的 ctx 无关
+func WithLoadTimeout(timeout time.Duration) SingleflightOption {
+	return func(s *singleflightConfig) {
+		s.loadTimeout = timeout
+	}
+}
+
+func NewSinglflightCache(cache Cache, loadFunc func(ctx context.Context, key string) (any, error),
+	opts ...SingleflightOption) *SingleflightCacheV1 {
+	cfg := &singleflightConfig{loadTimeout: defaultLoadTimeout}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	g := &loadGroup{}
 	return &SingleflightCacheV1{
 		ReadThrough: ReadThrough{
 			Cache: cache,
 			LoadFunc: func(ctx context.Context, key string) (any, error) {
-				v, err, _ := g.Do(key, func() (interface{}, error) {
+				return g.Do(ctx, key, cfg.loadTimeout, func(ctx context.Context) (any, error) {
 					return loadFunc(ctx, key)
 				})
-				return v, err
 			},
 		},
 	}
 }
 
 // SingleflightCacheV2 侵入式的方法
+// 加载和回写缓存都只执行一次, LoadTimeout 为 0 时使用 defaultLoadTimeout
 type SingleflightCacheV2 struct {
 	ReadThrough
-	g singleflight.Group
+	LoadTimeout time.Duration
+	g           loadGroup
 }
 
 func (r *SingleflightCacheV2) Get(ctx context.Context, key string) (any, error) {
-	data, err := r.Cache.Get(ctx, key)
-	if err == errs.ErrKeyNotFound {
-		data, err, _ = r.g.Do(key, func() (interface{}, error) {
-			v, er := r.LoadFunc(ctx, key)
-			if er == nil {
-				er = r.Cache.Set(ctx, key, data, r.ExpireTime)
-				if er != nil {
-					return v, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, er.Error())
-				}
-			}
-			return v, er
-		})
-	}
-	return data, err
+	val, err := r.Cache.Get(ctx, key)
+	if !errors.Is(err, errs.ErrKeyNotFound) {
+		return val, err
+	}
+	return r.g.Do(ctx, key, r.LoadTimeout, func(ctx context.Context) (any, error) {
+		v, er := r.LoadFunc(ctx, key)
+		if er != nil {
+			return nil, er
+		}
+		if er = r.Cache.Set(ctx, key, v, r.ExpireTime); er != nil {
+			return v, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, er.Error())
+		}
+		return v, nil
+	})
 }
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflightCacheV1_Get(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	c := NewSinglflightCache(NewBuildInMapCache(time.Minute), func(ctx context.Context, key string) (any, error) {
+		atomic.AddInt32(&loads, 1)
+		select {
+		case <-release:
+			return "value1", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	// 第一个调用方被取消, 不影响其它调用方
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, "key1")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.Get(context.Background(), "key1")
+			assert.NoError(t, err)
+			assert.Equal(t, "value1", val)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestSingleflightCacheV1_LoadTimeout(t *testing.T) {
+	c := NewSinglflightCache(NewBuildInMapCache(time.Minute), func(ctx context.Context, key string) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithLoadTimeout(10*time.Millisecond))
+	_, err := c.Get(context.Background(), "key1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestSingleflightCacheV2_Get(t *testing.T) {
+	errDB := errors.New("db error")
+	testCases := []struct {
+		name     string
+		loadFunc func(ctx context.Context, key string) (any, error)
+		wantVal  any
+		wantErr  error
+	}{
+		{
+			name: "load",
+			loadFunc: func(ctx context.Context, key string) (any, error) {
+				return "value1", nil
+			},
+			wantVal: "value1",
+		},
+		{
+			name: "load error",
+			loadFunc: func(ctx context.Context, key string) (any, error) {
+				return nil, errDB
+			},
+			wantErr: errDB,
+		},
+		{
+			name: "panic",
+			loadFunc: func(ctx context.Context, key string) (any, error) {
+				panic("boom")
+			},
+			wantErr: ErrLoadPanic,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			local := NewBuildInMapCache(time.Minute)
+			c := &SingleflightCacheV2{
+				ReadThrough: ReadThrough{
+					Cache:      local,
+					LoadFunc:   tc.loadFunc,
+					ExpireTime: time.Minute,
+				},
+			}
+			val, err := c.Get(context.Background(), "key1")
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVal, val)
+			// 缓存的是加载到的值
+			val, err = local.Get(context.Background(), "key1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+}
+
+func TestSingleflightCacheV2_WaiterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	c := &SingleflightCacheV2{
+		ReadThrough: ReadThrough{
+			Cache: NewBuildInMapCache(time.Minute),
+			LoadFunc: func(ctx context.Context, key string) (any, error) {
+				<-release
+				return "value1", nil
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, "key1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// 超时的调用方退出之后加载继续执行, 结果依然会写入缓存
+	close(release)
+	assert.Eventually(t, func() bool {
+		val, err := c.Cache.Get(context.Background(), "key1")
+		return err == nil && val == "value1"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDetachedContext(t *testing.T) {
+	type ctxKey struct{}
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "trace"))
+	cancel()
+	ctx := detachedContext{parent: parent}
+	assert.NoError(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	assert.Equal(t, "trace", ctx.Value(ctxKey{}))
+}
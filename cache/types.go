@@ -6,9 +6,19 @@ import (
 	"time"
 )
 
+// Cache 所有实现都需要满足 cachetest.RunSuite 中的语义
+// 特别是未命中时返回的 error 需要满足 errors.Is(err, errs.ErrKeyNotFound)
 type Cache interface {
 	Get(ctx context.Context, key string) (any, error)
 	Set(ctx context.Context, key string, value any, expireTime time.Duration) error
 	Delete(ctx context.Context, key string) error
 	LoadAndDelete(ctx context.Context, key string) (any, error)
 }
+
+// BatchCache 支持批量操作的缓存
+type BatchCache interface {
+	// GetMulti 未命中的 key 不会出现在结果中
+	GetMulti(ctx context.Context, keys []string) (map[string]any, error)
+	SetMulti(ctx context.Context, kvs map[string]any, expireTime time.Duration) error
+	DeleteMulti(ctx context.Context, keys []string) error
+}
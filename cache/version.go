@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"strconv"
+	"time"
+)
+
+// 乐观锁: 每个值带有一个版本号, 每次写入加一. 读取时同时拿到版本号, 写入时只有版本号没有变化才成功,
+// 否则说明期间有其它写入, 需要重新读取之后再修改, 避免并发的 读取 -> 修改 -> 写入 丢失更新
+// key 被删除之后版本号从头开始, 因此删除和重新创建之间的并发修改无法被发现(ABA)
+// RedisCache 需要通过 WithVersioning 开启版本号, 值依旧是普通的字符串, 版本号保存在与 key 同一个 slot 的另一个 key 中(见 versionKey),
+// 开启之后 Set, SetMulti 和 SetWithLease 同样增加版本号, Delete 和 LoadAndDelete 同时删除版本号
+
+var (
+	ErrVersionConflict = errors.New("cache: 版本号冲突")
+	// ErrVersioningDisabled 没有开启版本号时普通的 Set 不会增加版本号, 乐观锁发现不了并发的写入
+	ErrVersioningDisabled = errors.New("cache: 没有开启版本号, 见 WithVersioning")
+
+	//go:embed lua/version_set.lua
+	versionSetLua string
+)
+
+// VersionedCache 支持乐观锁的缓存
+type VersionedCache interface {
+	// GetWithVersion 未命中时返回 errs.ErrKeyNotFound, 版本号为 0
+	GetWithVersion(ctx context.Context, key string) (any, uint64, error)
+	// SetIfVersion 当前版本号等于 version 时写入, 否则返回 ErrVersionConflict
+	// version 为 0 表示 key 不存在时才写入
+	SetIfVersion(ctx context.Context, key string, value any, expireTime time.Duration, version uint64) error
+}
+
+func (l *BuildInMapCache) GetWithVersion(ctx context.Context, key string) (any, uint64, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	v, ok := l.m[key]
+	// 过期的数据交给 Get 或者定时任务删除
+	if !ok || v.deadlineBefore(time.Now()) {
+		return nil, 0, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	return v.value, v.version, nil
+}
+
+func (l *BuildInMapCache) SetIfVersion(ctx context.Context, key string, value any, expireTime time.Duration, version uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var cur uint64
+	if v, ok := l.m[key]; ok && !v.deadlineBefore(time.Now()) {
+		cur = v.version
+	}
+	if cur != version {
+		return fmt.Errorf("%w, key: %s, 期望 %d, 实际 %d", ErrVersionConflict, key, version, cur)
+	}
+	return l.set(ctx, key, value, expireTime)
+}
+
+// GetWithVersion 没有版本号的 key(例如开启版本号之前写入的)版本号为 0
+// 没有开启版本号时返回 ErrVersioningDisabled
+func (r *RedisCache) GetWithVersion(ctx context.Context, key string) (any, uint64, error) {
+	if !r.versioning {
+		return nil, 0, ErrVersioningDisabled
+	}
+	vals, err := r.client.MGet(ctx, key, versionKey(key)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	val, ok := vals[0].(string)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w, key: %s", errs.ErrKeyNotFound, key)
+	}
+	var version uint64
+	if ver, ok := vals[1].(string); ok {
+		version, err = strconv.ParseUint(ver, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cache: 版本号格式错误, key: %s, 原因：%w", key, err)
+		}
+	}
+	if r.codec != nil {
+		return []byte(val), version, nil
+	}
+	return val, version, nil
+}
+
+// SetIfVersion 没有开启版本号时返回 ErrVersioningDisabled
+func (r *RedisCache) SetIfVersion(ctx context.Context, key string, value any, expireTime time.Duration, version uint64) error {
+	if !r.versioning {
+		return ErrVersioningDisabled
+	}
+	value, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	res, err := r.client.Eval(ctx, versionSetLua, []string{key, versionKey(key)},
+		version, value, expireTime.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return fmt.Errorf("%w, key: %s, 期望 %d", ErrVersionConflict, key, version)
+	}
+	return nil
+}
+
+// setWithVersion 不检查版本号, 写入并增加版本号
+func (r *RedisCache) setWithVersion(ctx context.Context, key string, value any, expireTime time.Duration) error {
+	result, err := r.client.Eval(ctx, versionSetLua, []string{key, versionKey(key)},
+		-1, value, expireTime.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if result <= 0 {
+		return fmt.Errorf("%w, 返回信息 %d", errs.ErrFailedToSetCache, result)
+	}
+	return nil
+}
+
+// versionKey 版本号保存在单独的 key 中, 与 key 落在同一个 slot
+func versionKey(key string) string {
+	return companionKey(key, ":version")
+}
+
+// Updater 基于乐观锁的 读取 -> 修改 -> 写入, 版本号冲突时按照 RetryStrategy 重试
+type Updater struct {
+	cache      VersionedCache
+	expireTime time.Duration
+	// RetryStrategy 是有状态的, 每次 Update 都需要一个新的
+	newRetry func() RetryStrategy
+}
+
+type UpdaterOption func(u *Updater)
+
+// WithUpdateRetry 默认间隔 10ms, 最多重试 10 次
+func WithUpdateRetry(fn func() RetryStrategy) UpdaterOption {
+	return func(u *Updater) {
+		u.newRetry = fn
+	}
+}
+
+func NewUpdater(cache VersionedCache, expireTime time.Duration, opts ...UpdaterOption) *Updater {
+	res := &Updater{
+		cache:      cache,
+		expireTime: expireTime,
+		newRetry: func() RetryStrategy {
+			return &FixedIntervalRetryStrategy{
+				Interval: 10 * time.Millisecond,
+				MaxCnt:   10,
+			}
+		},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// Update fn 根据当前的值计算新的值, key 不存在时 val 为 nil. fn 可能被执行多次, 不能有副作用
+// fn 返回 error 时直接返回, 不会重试. 重试耗尽之后返回 ErrVersionConflict
+func (u *Updater) Update(ctx context.Context, key string, fn func(val any) (any, error)) (any, error) {
+	var (
+		retry RetryStrategy
+		timer *time.Timer
+	)
+	for {
+		val, version, err := u.cache.GetWithVersion(ctx, key)
+		if err != nil && !errors.Is(err, errs.ErrKeyNotFound) {
+			return nil, err
+		}
+		newVal, err := fn(val)
+		if err != nil {
+			return nil, err
+		}
+		err = u.cache.SetIfVersion(ctx, key, newVal, u.expireTime, version)
+		if err == nil {
+			return newVal, nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return nil, err
+		}
+		if retry == nil {
+			retry = u.newRetry()
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			return nil, fmt.Errorf("%w, 超出重试限制, key: %s", ErrVersionConflict, key)
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisCache_Update_e2e(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := NewRedisCache(client, WithVersioning())
+	require.NoError(t, c.Delete(ctx, "version-key"))
+	defer c.Delete(ctx, "version-key")
+
+	u := NewUpdater(c, time.Minute, WithUpdateRetry(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1000}
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := u.Update(ctx, "version-key", func(val any) (any, error) {
+					if val == nil {
+						return 1, nil
+					}
+					n, err := strconv.Atoi(val.(string))
+					return n + 1, err
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	val, version, err := c.GetWithVersion(ctx, "version-key")
+	require.NoError(t, err)
+	assert.Equal(t, "100", val)
+	assert.Equal(t, uint64(100), version)
+
+	// 值依旧是普通的字符串, 普通的 Get 和 Set 可以直接使用, Set 同样会增加版本号
+	val, err = c.Get(ctx, "version-key")
+	require.NoError(t, err)
+	assert.Equal(t, "100", val)
+	require.NoError(t, c.Set(ctx, "version-key", "200", time.Minute))
+	assert.True(t, errors.Is(c.SetIfVersion(ctx, "version-key", "101", time.Minute, 100), ErrVersionConflict))
+	_, version, err = c.GetWithVersion(ctx, "version-key")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(101), version)
+
+	// 删除之后版本号从头开始
+	_, err = c.LoadAndDelete(ctx, "version-key")
+	require.NoError(t, err)
+	_, _, err = c.GetWithVersion(ctx, "version-key")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	require.NoError(t, c.SetIfVersion(ctx, "version-key", "1", time.Minute, 0))
+}
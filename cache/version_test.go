@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/cache/mocks"
+	"geek_cache/internal/errs"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuildInMapCache_Version(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	_, version, err := c.GetWithVersion(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	assert.Equal(t, uint64(0), version)
+
+	require.NoError(t, c.SetIfVersion(ctx, "key1", "value1", time.Minute, 0))
+	// key 已经存在
+	assert.True(t, errors.Is(c.SetIfVersion(ctx, "key1", "value2", time.Minute, 0), ErrVersionConflict))
+	val, version, err := c.GetWithVersion(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Equal(t, uint64(1), version)
+
+	// 普通的 Set 同样会增加版本号
+	require.NoError(t, c.Set(ctx, "key1", "value2", time.Minute))
+	assert.True(t, errors.Is(c.SetIfVersion(ctx, "key1", "value3", time.Minute, 1), ErrVersionConflict))
+	require.NoError(t, c.SetIfVersion(ctx, "key1", "value3", time.Minute, 2))
+	val, version, err = c.GetWithVersion(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value3", val)
+	assert.Equal(t, uint64(3), version)
+
+	// 过期之后视为不存在
+	require.NoError(t, c.Set(ctx, "key2", "value1", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, _, err = c.GetWithVersion(ctx, "key2")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+	require.NoError(t, c.SetIfVersion(ctx, "key2", "value2", time.Minute, 0))
+}
+
+func TestVersionKey(t *testing.T) {
+	for _, key := range []string{"key1", "user:1", "{user1}name", "a{b}c"} {
+		vk := versionKey(key)
+		assert.NotEqual(t, key, vk)
+		assert.NotEqual(t, leaseKey(key), vk)
+		assert.Equal(t, KeySlot(key), KeySlot(vk), key)
+	}
+}
+
+func TestUpdater_Update(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	u := NewUpdater(c, time.Minute, WithUpdateRetry(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1000}
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := u.Update(ctx, "counter", func(val any) (any, error) {
+					if val == nil {
+						return 1, nil
+					}
+					return val.(int) + 1, nil
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	val, err := c.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, 200, val)
+}
+
+// conflictCache 每次写入之前都有其它写入
+type conflictCache struct {
+	*BuildInMapCache
+	sets int
+}
+
+func (c *conflictCache) SetIfVersion(ctx context.Context, key string, value any, expireTime time.Duration, version uint64) error {
+	c.sets++
+	_ = c.Set(ctx, key, value, expireTime)
+	return c.BuildInMapCache.SetIfVersion(ctx, key, value, expireTime, version)
+}
+
+func TestUpdater_RetryExhausted(t *testing.T) {
+	ctx := context.Background()
+	c := &conflictCache{BuildInMapCache: NewBuildInMapCache(time.Minute)}
+	defer c.Close()
+	u := NewUpdater(c, time.Minute, WithUpdateRetry(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}
+	}))
+	_, err := u.Update(ctx, "key1", func(val any) (any, error) {
+		return "value1", nil
+	})
+	assert.True(t, errors.Is(err, ErrVersionConflict))
+	assert.Equal(t, 4, c.sets)
+
+	// fn 返回的 error 不会重试
+	errFn := errors.New("fn error")
+	_, err = u.Update(ctx, "key1", func(val any) (any, error) {
+		return nil, errFn
+	})
+	assert.Equal(t, errFn, err)
+	assert.Equal(t, 4, c.sets)
+}
+
+func TestRedisCache_GetWithVersion(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name        string
+		vals        []any
+		wantVal     any
+		wantVersion uint64
+		wantErr     error
+	}{
+		{
+			name:        "hit",
+			vals:        []any{"value1", "3"},
+			wantVal:     "value1",
+			wantVersion: 3,
+		},
+		{
+			// 开启版本号之前写入的 key
+			name:    "no version",
+			vals:    []any{"value1", nil},
+			wantVal: "value1",
+		},
+		{
+			name:    "miss",
+			vals:    []any{nil, nil},
+			wantErr: errs.ErrKeyNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			cmd.EXPECT().MGet(ctx, "key1", "{key1}:version").
+				Return(redis.NewSliceResult(tc.vals, nil))
+			val, version, err := NewRedisCache(cmd, WithVersioning()).GetWithVersion(ctx, "key1")
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantVal, val)
+			assert.Equal(t, tc.wantVersion, version)
+		})
+	}
+}
+
+func TestRedisCache_SetIfVersion(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		result  int64
+		wantErr error
+	}{
+		{
+			name:   "set",
+			result: 4,
+		},
+		{
+			name:    "conflict",
+			result:  0,
+			wantErr: ErrVersionConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(ctx)
+			res.SetVal(tc.result)
+			cmd.EXPECT().Eval(ctx, versionSetLua, []string{"key1", "{key1}:version"}, uint64(3), "value1", int64(60000)).
+				Return(res)
+			err := NewRedisCache(cmd, WithVersioning()).SetIfVersion(ctx, "key1", "value1", time.Minute, 3)
+			assert.True(t, errors.Is(err, tc.wantErr))
+		})
+	}
+}
+
+func TestRedisCache_VersioningDisabled(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// 没有开启版本号时不会访问 redis
+	c := NewRedisCache(mocks.NewMockCmdable(ctrl))
+	_, _, err := c.GetWithVersion(ctx, "key1")
+	assert.Equal(t, ErrVersioningDisabled, err)
+	assert.Equal(t, ErrVersioningDisabled, c.SetIfVersion(ctx, "key1", "value1", time.Minute, 0))
+}
+
+func TestRedisCache_Versioning(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	// 开启版本号之后普通的写入同样增加版本号, 删除时同时删除版本号
+	cmd.EXPECT().Eval(ctx, versionSetLua, []string{"key1", "{key1}:version"}, -1, "value1", int64(60000)).
+		Return(evalResult(int64(2)))
+	cmd.EXPECT().Del(ctx, "key1", "{key1}:lease", "{key1}:version").Return(redis.NewIntResult(3, nil))
+	cmd.EXPECT().Eval(ctx, getDelLua, []string{"key1", "{key1}:lease", "{key1}:version"}).
+		Return(evalResult("value1"))
+	cmd.EXPECT().Eval(ctx, leaseSetLua, []string{"key1", "{key1}:lease", "{key1}:version"}, "lease1", "value1", int64(60000)).
+		Return(evalResult(int64(1)))
+
+	c := NewRedisCache(cmd, WithVersioning())
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, c.Delete(ctx, "key1"))
+	val, err := c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	require.NoError(t, c.SetWithLease(ctx, "key1", "value1", time.Minute, "lease1"))
+
+	failed := evalResult(nil)
+	failed.SetErr(context.DeadlineExceeded)
+	cmd.EXPECT().Eval(ctx, versionSetLua, []string{"key1", "{key1}:version"}, -1, "value1", int64(60000)).
+		Return(failed)
+	assert.Equal(t, context.DeadlineExceeded, c.Set(ctx, "key1", "value1", time.Minute))
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geek_cache/internal/errs"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// XFetch 提前刷新: 缓存的值附带加载耗时 delta 和过期时间 expiry, 每次读取时如果
+// now - delta*beta*ln(rand) >= expiry 就由当前请求重新加载. 越接近过期, 重新加载的概率越大,
+// 加载越慢越早开始刷新, 因此大量请求不会在过期的那一刻同时回源, 也不需要后台 goroutine
+// 参考 Optimal Probabilistic Cache Stampede Prevention(Vattani, Chierichetti, Lowenstein)
+//
+// 元数据和值一起编码成 []byte 写入 Cache, 所以 Cache 必须原样存取 []byte:
+// RedisCache 不能配置 JSONCodec, GobCodec 这类会改变字节的 codec(不配置或者使用 BytesCodec),
+// 否则 Get 返回的是编码之后的数据, 识别不出元数据, 会被当作普通的值原样返回
+
+// xfetchMagic 标识带有 XFetch 元数据的值, 直接通过 Set 写入的值没有这个前缀, 读取时原样返回
+var xfetchMagic = []byte{0xff, 'X', 'F'}
+
+const (
+	// 头部: magic(3) + 值类型(1) + 过期时间(8) + 加载耗时(8)
+	xfetchHeaderSize = 3 + 1 + 8 + 8
+
+	xfetchBytes  byte = 0
+	xfetchString byte = 1
+)
+
+// xfetchRand 返回 (0, 1] 的随机数, 测试时替换
+var xfetchRand = func() float64 {
+	return 1 - rand.Float64()
+}
+
+type xfetchEntry struct {
+	value  any
+	expiry time.Time
+	delta  time.Duration
+}
+
+// shouldRefresh expiry 为零值表示永不过期
+func (e *xfetchEntry) shouldRefresh(now time.Time, beta float64) bool {
+	if e.expiry.IsZero() {
+		return false
+	}
+	gap := time.Duration(float64(e.delta) * beta * -math.Log(xfetchRand()))
+	return !now.Add(gap).Before(e.expiry)
+}
+
+// encodeXFetchEntry 值必须是 []byte 或者 string, 解码之后保持原来的类型
+func encodeXFetchEntry(e xfetchEntry) ([]byte, error) {
+	data, err := BytesCodec{}.Encode(e.value)
+	if err != nil {
+		return nil, err
+	}
+	kind := xfetchBytes
+	if _, ok := e.value.(string); ok {
+		kind = xfetchString
+	}
+	res := make([]byte, xfetchHeaderSize, xfetchHeaderSize+len(data))
+	copy(res, xfetchMagic)
+	res[3] = kind
+	var expiry int64
+	if !e.expiry.IsZero() {
+		expiry = e.expiry.UnixNano()
+	}
+	binary.BigEndian.PutUint64(res[4:12], uint64(expiry))
+	binary.BigEndian.PutUint64(res[12:20], uint64(e.delta))
+	return append(res, data...), nil
+}
+
+// decodeXFetchEntry 第二个返回值为 false 表示不是 XFetch 写入的值
+func decodeXFetchEntry(val any) (xfetchEntry, bool) {
+	// RedisCache 没有配置 codec 时返回的是 string
+	data, err := BytesCodec{}.Encode(val)
+	if err != nil {
+		return xfetchEntry{}, false
+	}
+	if len(data) < xfetchHeaderSize || !bytes.Equal(data[:3], xfetchMagic) || data[3] > xfetchString {
+		return xfetchEntry{}, false
+	}
+	e := xfetchEntry{
+		delta: time.Duration(binary.BigEndian.Uint64(data[12:20])),
+	}
+	if expiry := int64(binary.BigEndian.Uint64(data[4:12])); expiry > 0 {
+		e.expiry = time.Unix(0, expiry)
+	}
+	if data[3] == xfetchString {
+		e.value = string(data[xfetchHeaderSize:])
+	} else {
+		e.value = data[xfetchHeaderSize:]
+	}
+	return e, true
+}
+
+// getXFetch 提前刷新失败时返回旧值, 旧值此时还没有过期
+func (r *ReadThrough) getXFetch(ctx context.Context, key string) (any, error) {
+	val, err := r.Cache.Get(ctx, key)
+	if err == nil {
+		entry, ok := decodeXFetchEntry(val)
+		if !ok {
+			return val, nil
+		}
+		if !entry.shouldRefresh(time.Now(), r.XFetchBeta) {
+			return entry.value, nil
+		}
+		if newVal, er := r.loadXFetch(ctx, key); er == nil {
+			return newVal, nil
+		}
+		return entry.value, nil
+	}
+	if !errors.Is(err, errs.ErrKeyNotFound) {
+		return nil, err
+	}
+	return r.loadXFetch(ctx, key)
+}
+
+func (r *ReadThrough) loadXFetch(ctx context.Context, key string) (any, error) {
+	start := time.Now()
+	val, err := r.LoadFunc(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := xfetchEntry{value: val, delta: now.Sub(start)}
+	if r.ExpireTime > 0 {
+		entry.expiry = now.Add(r.ExpireTime)
+	}
+	// 类型不对的值无法写入缓存, 与写缓存失败一样返回加载到的值, 不能让每次 Get 都失败
+	data, err := encodeXFetchEntry(entry)
+	if err != nil {
+		return val, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, err.Error())
+	}
+	if err = r.Cache.Set(ctx, key, data, r.ExpireTime); err != nil {
+		return val, fmt.Errorf("%w, 原因：%s", ErrFailedToRefreshCache, err.Error())
+	}
+	return val, nil
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"geek_cache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestXFetchEntry_Encode(t *testing.T) {
+	expiry := time.Unix(100, 0)
+	for _, val := range []any{"value", []byte("value")} {
+		data, err := encodeXFetchEntry(xfetchEntry{value: val, expiry: expiry, delta: time.Second})
+		require.NoError(t, err)
+		// RedisCache 没有配置 codec 时读出来的是 string
+		for _, stored := range []any{data, string(data)} {
+			entry, ok := decodeXFetchEntry(stored)
+			require.True(t, ok)
+			assert.Equal(t, val, entry.value)
+			assert.True(t, expiry.Equal(entry.expiry))
+			assert.Equal(t, time.Second, entry.delta)
+		}
+	}
+	_, err := encodeXFetchEntry(xfetchEntry{value: 123})
+	assert.True(t, errors.Is(err, ErrCodecUnsupportedType))
+	_, ok := decodeXFetchEntry("plain value")
+	assert.False(t, ok)
+}
+
+func TestXFetchEntry_ShouldRefresh(t *testing.T) {
+	defer func(origin func() float64) {
+		xfetchRand = origin
+	}(xfetchRand)
+	// -ln(0.5) ≈ 0.69
+	xfetchRand = func() float64 {
+		return 0.5
+	}
+	now := time.Unix(100, 0)
+	entry := xfetchEntry{expiry: now.Add(time.Second), delta: time.Second}
+	assert.False(t, entry.shouldRefresh(now, 1))
+	// beta 越大越早刷新
+	assert.True(t, entry.shouldRefresh(now, 2))
+	assert.True(t, entry.shouldRefresh(now.Add(400*time.Millisecond), 1))
+	// 永不过期
+	assert.False(t, (&xfetchEntry{delta: time.Hour}).shouldRefresh(now, 1))
+}
+
+func TestReadThrough_XFetch(t *testing.T) {
+	ctx := context.Background()
+	local := NewBuildInMapCache(time.Minute)
+	loads := 0
+	var loadErr error
+	r := &ReadThrough{
+		Cache: local,
+		LoadFunc: func(ctx context.Context, key string) (any, error) {
+			loads++
+			if loadErr != nil {
+				return nil, loadErr
+			}
+			return "value", nil
+		},
+		ExpireTime: time.Minute,
+		XFetchBeta: 1,
+	}
+
+	// 未命中时加载, 并保存加载耗时
+	val, err := r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+	val, err = r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+	assert.Equal(t, 1, loads)
+
+	// 即将过期并且加载很慢, 提前刷新
+	data, err := encodeXFetchEntry(xfetchEntry{value: "old", expiry: time.Now().Add(time.Millisecond), delta: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, local.Set(ctx, "key1", data, time.Minute))
+	val, err = r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+	assert.Equal(t, 2, loads)
+
+	// 提前刷新失败时返回旧值
+	require.NoError(t, local.Set(ctx, "key1", data, time.Minute))
+	loadErr = errors.New("db error")
+	val, err = r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "old", val)
+
+	// 直接写入的值原样返回
+	require.NoError(t, local.Set(ctx, "key2", "plain", time.Minute))
+	val, err = r.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", val)
+}
+
+func TestReadThrough_XFetchUnsupportedType(t *testing.T) {
+	ctx := context.Background()
+	local := NewBuildInMapCache(time.Minute)
+	r := &ReadThrough{
+		Cache: local,
+		LoadFunc: func(ctx context.Context, key string) (any, error) {
+			return 123, nil
+		},
+		ExpireTime: time.Minute,
+		XFetchBeta: 1,
+	}
+	// 返回加载到的值, 但是不写入缓存
+	val, err := r.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, ErrFailedToRefreshCache))
+	assert.Equal(t, 123, val)
+	_, err = local.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, errs.ErrKeyNotFound))
+}
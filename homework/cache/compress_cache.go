@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"geek_cache/cache"
+	"time"
+)
+
+// CompressCache 压缩装饰器, 超过阈值的值在写入前压缩
+// 压缩格式与 cache.CompressCache 一致, 两者可以读写同一份数据
+type CompressCache struct {
+	Cache
+	compression *cache.Compression
+}
+
+func NewCompressCache(c Cache, compression *cache.Compression) *CompressCache {
+	return &CompressCache{
+		Cache:       c,
+		compression: compression,
+	}
+}
+
+func (c *CompressCache) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.compression.Decompress(val)
+}
+
+func (c *CompressCache) Set(ctx context.Context, key string, val []byte,
+	expiration time.Duration) error {
+	data, err := c.compression.Compress(val)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Set(ctx, key, data, expiration)
+}
+
+func (c *CompressCache) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	val, err := c.Cache.LoadAndDelete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.compression.Decompress(val)
+}
+
+// OnEvicted 回调拿到的是解压之后的值, 解压失败时传入原始数据
+// 注意 MaxMemoryCache 统计的是压缩之后的大小, 因此应该让 CompressCache 在外层
+func (c *CompressCache) OnEvicted(fn func(key string, val []byte)) {
+	c.Cache.OnEvicted(func(key string, val []byte) {
+		data, err := c.compression.Decompress(val)
+		if err != nil {
+			data = val
+		}
+		fn(key, data)
+	})
+}
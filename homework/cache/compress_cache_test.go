@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"geek_cache/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCompressCache(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  []byte
+		// 底层缓存中的数据是否被压缩
+		wantCompressed bool
+	}{
+		{
+			name: "small value",
+			val:  []byte("hello"),
+		},
+		{
+			name:           "large value",
+			val:            bytes.Repeat([]byte("hello"), 100),
+			wantCompressed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := &mockCache{data: map[string][]byte{}}
+			compression, err := cache.NewCompression(cache.GzipCompressor{}, 64)
+			require.NoError(t, err)
+			c := NewCompressCache(mc, compression)
+			var evicted []byte
+			c.OnEvicted(func(key string, val []byte) {
+				evicted = val
+			})
+			err = c.Set(context.Background(), "key1", tc.val, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCompressed, len(mc.data["key1"]) < len(tc.val))
+
+			val, err := c.Get(context.Background(), "key1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.val, val)
+
+			require.NoError(t, c.Delete(context.Background(), "key1"))
+			assert.Equal(t, tc.val, evicted)
+		})
+	}
+}
@@ -7,4 +7,5 @@ var (
 	ErrKeyNotFound      = errors.New("cache：键不存在")
 	ErrOverCapacity     = errors.New("cache：超过容量限制")
 	ErrFailedToSetCache = errors.New("cache: 写入 redis 失败")
+	ErrValueTooLarge    = errors.New("cache：值超过大小限制")
 )